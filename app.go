@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"sync"
 	"wailts/models"
 	"wailts/transactionImport"
 
@@ -12,14 +13,25 @@ import (
 
 // App struct
 type App struct {
-	ctx     context.Context
-	service *models.Service
+	ctx         context.Context
+	service     *models.Service
+	importer    *transactionImport.Importer
+	inboxFolder string
+	inboxMu     sync.Mutex
+	inbox       *transactionImport.Watcher
 }
 
-// NewApp creates a new App application struct
-func NewApp(service *models.Service) *App {
+// NewApp creates a new App application struct.
+// importFolder is where a copy of every imported file is kept,
+// inboxFolder is where new downloads are picked up from.
+func NewApp(service *models.Service, importFolder string, inboxFolder string) *App {
 	return &App{
 		service: service,
+		importer: &transactionImport.Importer{
+			DB:         service.DB,
+			ArchiveDir: importFolder,
+		},
+		inboxFolder: inboxFolder,
 	}
 }
 
@@ -27,6 +39,14 @@ func NewApp(service *models.Service) *App {
 // so we can call the runtime methods
 func (a *App) startup(ctx context.Context) {
 	a.ctx = ctx
+	for _, note := range a.service.UpgradeNotes {
+		runtime.LogWarning(a.ctx, note)
+	}
+}
+
+// shutdown is called when the app is closing
+func (a *App) shutdown(ctx context.Context) {
+	a.StopInboxWatcher()
 }
 
 // --- Database Admin ---
@@ -39,57 +59,189 @@ func (a *App) CleanDatabase() error {
 
 func (a *App) SelectFile() (string, error) {
 	return runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
-		Title: "Select CSV File",
+		Title: "Select Download File",
 		Filters: []runtime.FileFilter{
+			{DisplayName: "Download Files", Pattern: "*.csv;*.ofx;*.qfx;*.qif;*.pdf"},
 			{DisplayName: "CSV Files", Pattern: "*.csv"},
+			{DisplayName: "OFX/QFX Files", Pattern: "*.ofx;*.qfx"},
+			{DisplayName: "QIF Files", Pattern: "*.qif"},
+			{DisplayName: "PDF Statements", Pattern: "*.pdf"},
 		},
 	})
 }
 
-func (a *App) ImportFile(accountID string, filePath string) (string, error) {
+// DetectAccount proposes the account a downloaded file came from.
+func (a *App) DetectAccount(filePath string) (string, error) {
+	account, matches, err := transactionImport.DetectAccount(a.service.DB, filePath)
+	for _, m := range matches {
+		runtime.LogDebug(a.ctx, fmt.Sprintf("DetectAccount %s: %s scores %.2f %s", filePath, m.Account, m.Score, m.Reason))
+	}
+	return account, err
+}
+
+// ImportFile stages the transactions in a downloaded file, archives the file
+// and reports which rows were rejected.  ImportProgressEvent is emitted as
+// the file is read.
+// An empty accountID means detect the account from the file.
+func (a *App) ImportFile(accountID string, filePath string) (*transactionImport.ImportReport, error) {
 	runtime.LogInfo(a.ctx, fmt.Sprintf("ImportFile called for account: %s, file: %s", accountID, filePath))
 
-	// Open File
-	f, err := os.Open(filePath)
+	report, err := a.importer.ImportFile(accountID, filePath, func(p transactionImport.FileProgress) {
+		runtime.EventsEmit(a.ctx, ImportProgressEvent, p)
+	})
 	if err != nil {
-		runtime.LogError(a.ctx, fmt.Sprintf("Error opening file: %s", err))
-		return "", err
+		runtime.LogError(a.ctx, fmt.Sprintf("Error importing file: %s", err))
+		return nil, err
+	}
+	for _, w := range report.Warnings {
+		runtime.LogWarning(a.ctx, w)
+	}
+	for _, r := range report.Rejected {
+		runtime.LogWarning(a.ctx, fmt.Sprintf("Rejected line %d (%s): %s", r.Line, r.Reason, r.Raw))
 	}
-	defer f.Close()
 
-	// Create Parser based on AccountID (Name)
-	parser, err := transactionImport.GetParser(accountID)
+	runtime.LogInfo(a.ctx, report.Message)
+	return report, nil
+}
+
+// PreviewImport reports what importing a file would do, without changing anything.
+// An empty accountID means detect the account from the file.
+func (a *App) PreviewImport(accountID string, filePath string) (*transactionImport.ImportPreview, error) {
+	runtime.LogInfo(a.ctx, fmt.Sprintf("PreviewImport called for account: %s, file: %s", accountID, filePath))
+
+	preview, err := a.importer.PreviewImport(accountID, filePath)
 	if err != nil {
-		runtime.LogError(a.ctx, fmt.Sprintf("Error getting parser: %s", err))
-		return "", err
+		runtime.LogError(a.ctx, fmt.Sprintf("Error previewing import: %s", err))
+		return nil, err
+	}
+	runtime.LogInfo(a.ctx, preview.Message)
+	return preview, nil
+}
+
+// ImportProgressEvent is emitted with a transactionImport.FileProgress as each
+// file of a folder import, or each download arriving in the inbox, is imported.
+const ImportProgressEvent = "import:progress"
+
+func (a *App) emitImportProgress(p transactionImport.FileProgress) {
+	runtime.LogInfo(a.ctx, fmt.Sprintf("Import %s: %s %s", p.File, p.Status, p.Message))
+	runtime.EventsEmit(a.ctx, ImportProgressEvent, p)
+}
+
+// SelectFolder asks for a folder of downloads, starting in the inbox
+func (a *App) SelectFolder() (string, error) {
+	return runtime.OpenDirectoryDialog(a.ctx, runtime.OpenDialogOptions{
+		Title:            "Select Download Folder",
+		DefaultDirectory: a.inboxFolder,
+	})
+}
+
+// ImportFolder imports every download in a folder that hasn't been imported before,
+// detecting each file's account.  An empty path means the inbox folder.
+func (a *App) ImportFolder(path string) (*transactionImport.FolderReport, error) {
+	if path == "" {
+		path = a.inboxFolder
 	}
-	runtime.LogInfo(a.ctx, fmt.Sprintf("Using parser for: %s", accountID))
+	runtime.LogInfo(a.ctx, fmt.Sprintf("ImportFolder called for: %s", path))
 
-	// Parse
-	records, err := parser.Parse(f)
+	report, err := a.importer.ImportFolder(path, a.emitImportProgress)
 	if err != nil {
-		runtime.LogError(a.ctx, fmt.Sprintf("Error parsing file: %s", err))
-		return "", err
+		runtime.LogError(a.ctx, fmt.Sprintf("Error importing folder: %s", err))
+		return nil, err
 	}
-	runtime.LogInfo(a.ctx, fmt.Sprintf("Parsed %d records", len(records)))
+	runtime.LogInfo(a.ctx, report.Message)
+	return report, nil
+}
 
-	// Process
-	err = transactionImport.ProcessRaw(a.service.DB, accountID, records)
+// StartInboxWatcher imports downloads as they are saved into the inbox folder,
+// emitting ImportProgressEvent for each.
+func (a *App) StartInboxWatcher() error {
+	a.inboxMu.Lock()
+	defer a.inboxMu.Unlock()
+	if a.inbox != nil {
+		return nil
+	}
+	w, err := a.importer.Watch(a.inboxFolder, a.emitImportProgress)
 	if err != nil {
-		runtime.LogError(a.ctx, fmt.Sprintf("Error processing raw transactions: %s", err))
-		return "", err
+		runtime.LogError(a.ctx, fmt.Sprintf("Error watching inbox %s: %s", a.inboxFolder, err))
+		return err
 	}
+	a.inbox = w
+	runtime.LogInfo(a.ctx, fmt.Sprintf("Watching inbox %s", a.inboxFolder))
+	return nil
+}
 
-	msg := fmt.Sprintf("Imported %d records", len(records))
-	runtime.LogInfo(a.ctx, msg)
-	return msg, nil
+// StopInboxWatcher stops StartInboxWatcher
+func (a *App) StopInboxWatcher() error {
+	a.inboxMu.Lock()
+	defer a.inboxMu.Unlock()
+	if a.inbox == nil {
+		return nil
+	}
+	err := a.inbox.Close()
+	a.inbox = nil
+	return err
 }
 
-func (a *App) ApplyTags() (string, error) {
-	count, err := a.service.ApplyTags()
+// IsInboxWatched reports whether the inbox watcher is running
+func (a *App) IsInboxWatched() bool {
+	a.inboxMu.Lock()
+	defer a.inboxMu.Unlock()
+	return a.inbox != nil
+}
+
+func (a *App) ApplyTags() (*models.ApplyTagsResult, error) {
+	result, err := a.service.ApplyTags()
 	if err != nil {
 		runtime.LogError(a.ctx, fmt.Sprintf("Error applying tags: %s", err))
+		return nil, err
+	}
+	return result, nil
+}
+
+// --- Exchange Rates ---
+
+// LoadExchangeRates asks for a CSV file of exchange rates and loads it.
+// It returns "" if the user cancels.
+func (a *App) LoadExchangeRates() (string, error) {
+	path, err := runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+		Title:   "Select Exchange Rates",
+		Filters: []runtime.FileFilter{{DisplayName: "CSV Files", Pattern: "*.csv"}},
+	})
+	if err != nil || path == "" {
+		return "", err
+	}
+	msg, err := a.service.LoadExchangeRatesFile(path)
+	if err != nil {
+		runtime.LogError(a.ctx, err.Error())
+		return "", err
+	}
+	return msg, nil
+}
+
+// --- Export ---
+
+// ExportQIF asks where to save a QIF file and writes every transaction to it,
+// so the data can be taken to another program.  It returns "" if the user cancels.
+func (a *App) ExportQIF() (string, error) {
+	path, err := runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+		Title:           "Export Transactions",
+		DefaultFilename: "transactions.qif",
+		Filters:         []runtime.FileFilter{{DisplayName: "QIF Files", Pattern: "*.qif"}},
+	})
+	if err != nil || path == "" {
+		return "", err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	count, err := transactionImport.ExportQIF(a.service.DB, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		runtime.LogError(a.ctx, fmt.Sprintf("Error exporting to %s: %s", path, err))
 		return "", err
 	}
-	return fmt.Sprintf("Auto-applied budgets for %d transactions.", count), nil
+	return fmt.Sprintf("Exported %d transactions to %s.", count, path), nil
 }
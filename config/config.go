@@ -16,6 +16,8 @@ var Current *Config
 type Config struct {
 	DatabasePath string `toml:"database" json:"database"`
 	ImportPath   string `toml:"importFolder" json:"importFolder"`
+	InboxPath    string `toml:"inboxFolder" json:"inboxFolder"`
+	HomeCurrency string `toml:"homeCurrency" json:"homeCurrency"` // ISO 4217 code of amounts that don't say, and that reports convert to
 }
 
 // ToJSON returns the configuration as a JSON string
@@ -51,17 +53,22 @@ func Init() []string {
 	defaultConfigPath := filepath.Join(configHome, "budgetTracker", "config.toml")
 	defaultDatabasePath := filepath.Join(xdgDataHome, "budgetTracker", "budget.db")
 	defaultImportPath := filepath.Join(xdgDataHome, "budgetTracker", "importHistory")
+	defaultInboxPath := filepath.Join(xdgDataHome, "budgetTracker", "inbox")
 
 	Current.DatabasePath = defaultDatabasePath
 	Current.ImportPath = defaultImportPath
+	Current.InboxPath = defaultInboxPath
+	Current.HomeCurrency = "USD"
 
 	// 2. Define Flags (but define them locally variables to hold flag values)
 	// We don't want to overwrite defaults with empty strings if flags aren't set.
-	var flagConfig, flagDatabase, flagImport string
+	var flagConfig, flagDatabase, flagImport, flagInbox, flagCurrency string
 
 	flag.StringVar(&flagConfig, "config", "", "Path to configuration file")
 	flag.StringVar(&flagDatabase, "database", "", "Path to database file")
 	flag.StringVar(&flagImport, "importFolder", "", "Path to import history folder")
+	flag.StringVar(&flagInbox, "inboxFolder", "", "Path to folder watched for new downloads")
+	flag.StringVar(&flagCurrency, "homeCurrency", "", "Currency code that reports are converted to, e.g. USD")
 
 	flag.Parse()
 
@@ -90,6 +97,12 @@ func Init() []string {
 			if fileConfig.ImportPath != "" {
 				Current.ImportPath = fileConfig.ImportPath
 			}
+			if fileConfig.InboxPath != "" {
+				Current.InboxPath = fileConfig.InboxPath
+			}
+			if fileConfig.HomeCurrency != "" {
+				Current.HomeCurrency = fileConfig.HomeCurrency
+			}
 		} else {
 			fmt.Printf("Warning: Failed to parse config file at %s: %v\n", configPathToUse, err)
 		}
@@ -102,6 +115,12 @@ func Init() []string {
 	if envImport := os.Getenv("budgetTracker_importFolder"); envImport != "" {
 		Current.ImportPath = envImport
 	}
+	if envInbox := os.Getenv("budgetTracker_inboxFolder"); envInbox != "" {
+		Current.InboxPath = envInbox
+	}
+	if envCurrency := os.Getenv("budgetTracker_homeCurrency"); envCurrency != "" {
+		Current.HomeCurrency = envCurrency
+	}
 
 	// 5. Apply Flags (Override Env/File/Defaults)
 	if flagDatabase != "" {
@@ -110,6 +129,12 @@ func Init() []string {
 	if flagImport != "" {
 		Current.ImportPath = flagImport
 	}
+	if flagInbox != "" {
+		Current.InboxPath = flagInbox
+	}
+	if flagCurrency != "" {
+		Current.HomeCurrency = flagCurrency
+	}
 
 	// 6. Finalization: Ensure directories exist
 	dbDir := filepath.Dir(Current.DatabasePath)
@@ -119,6 +144,9 @@ func Init() []string {
 	if err := os.MkdirAll(Current.ImportPath, 0755); err != nil {
 		fmt.Printf("Warning: Failed to create import directory %s: %v\n", Current.ImportPath, err)
 	}
+	if err := os.MkdirAll(Current.InboxPath, 0755); err != nil {
+		fmt.Printf("Warning: Failed to create inbox directory %s: %v\n", Current.InboxPath, err)
+	}
 
 	return flag.Args()
 }
@@ -68,15 +68,18 @@ func TestInit_TableDriven(t *testing.T) {
 		configFileContent string
 		configFilePath    string // optional, relative to tempDir
 
-		expectedDb     string
-		expectedImport string
-		expectedArgs   []string
+		expectedDb       string
+		expectedImport   string
+		expectedInbox    string
+		expectedCurrency string // Empty means the default, USD
+		expectedArgs     []string
 	}{
 		{
 			name:           "Defaults",
 			args:           []string{"cmd"},
 			expectedDb:     "/data/budgetTracker/budget.db", // "data" is from XDG_DATA_HOME mock
 			expectedImport: "/data/budgetTracker/importHistory",
+			expectedInbox:  "/data/budgetTracker/inbox",
 			expectedArgs:   []string{},
 		},
 		{
@@ -85,17 +88,35 @@ func TestInit_TableDriven(t *testing.T) {
 			env: map[string]string{
 				"budgetTracker_database":     "/env/db.db",
 				"budgetTracker_importFolder": "/env/import",
+				"budgetTracker_inboxFolder":  "/env/inbox",
+				"budgetTracker_homeCurrency": "GBP",
 			},
-			expectedDb:     "/env/db.db",
-			expectedImport: "/env/import",
-			expectedArgs:   []string{},
+			expectedDb:       "/env/db.db",
+			expectedImport:   "/env/import",
+			expectedInbox:    "/env/inbox",
+			expectedCurrency: "GBP",
+			expectedArgs:     []string{},
 		},
 		{
-			name:           "Flag Override",
-			args:           []string{"cmd", "-database", "/flag/db.db", "-importFolder", "/flag/import"},
-			expectedDb:     "/flag/db.db",
-			expectedImport: "/flag/import",
-			expectedArgs:   []string{},
+			name:             "Flag Override",
+			args:             []string{"cmd", "-database", "/flag/db.db", "-importFolder", "/flag/import", "-inboxFolder", "/flag/inbox", "-homeCurrency", "CAD"},
+			expectedDb:       "/flag/db.db",
+			expectedImport:   "/flag/import",
+			expectedInbox:    "/flag/inbox",
+			expectedCurrency: "CAD",
+			expectedArgs:     []string{},
+		},
+		{
+			name: "Precedence Flag > Env > Config File (Inbox)",
+			args: []string{"cmd", "-inboxFolder", "/flag/inbox"},
+			env: map[string]string{
+				"budgetTracker_inboxFolder": "/env/inbox",
+			},
+			configFileContent: `inboxFolder = "/file/inbox"`,
+			configFilePath:    "config/budgetTracker/config.toml",
+			expectedDb:        "/data/budgetTracker/budget.db",
+			expectedInbox:     "/flag/inbox",
+			expectedArgs:      []string{},
 		},
 		{
 			name: "Precedence Flag > Env",
@@ -125,11 +146,15 @@ func TestInit_TableDriven(t *testing.T) {
 			configFileContent: `
 database = "/file/db.db"
 importFolder = "/file/import"
+inboxFolder = "/file/inbox"
+homeCurrency = "EUR"
 `,
-			configFilePath: "config/budgetTracker/config.toml",
-			expectedDb:     "/file/db.db",
-			expectedImport: "/file/import",
-			expectedArgs:   []string{},
+			configFilePath:   "config/budgetTracker/config.toml",
+			expectedDb:       "/file/db.db",
+			expectedImport:   "/file/import",
+			expectedInbox:    "/file/inbox",
+			expectedCurrency: "EUR",
+			expectedArgs:     []string{},
 		},
 		{
 			name: "Config File via Flag",
@@ -234,6 +259,18 @@ database = "/custom/db.db"
 					assert.Equal(t, filepath.Join(mockDataHome, "budgetTracker", "importHistory"), Current.ImportPath, "ImportPath mismatch (default)")
 				}
 
+				if tc.expectedInbox != "" {
+					assert.Equal(t, resolve(tc.expectedInbox), Current.InboxPath, "InboxPath mismatch")
+				} else {
+					assert.Equal(t, filepath.Join(mockDataHome, "budgetTracker", "inbox"), Current.InboxPath, "InboxPath mismatch (default)")
+				}
+
+				expectedCurrency := tc.expectedCurrency
+				if expectedCurrency == "" {
+					expectedCurrency = "USD"
+				}
+				assert.Equal(t, expectedCurrency, Current.HomeCurrency, "HomeCurrency mismatch")
+
 				assert.Equal(t, tc.expectedArgs, remainingArgs, "Args mismatch")
 			})
 		})
@@ -244,6 +281,8 @@ func TestToJSON(t *testing.T) {
 	config := &Config{
 		DatabasePath: "/db",
 		ImportPath:   "/import",
+		InboxPath:    "/inbox",
+		HomeCurrency: "EUR",
 	}
 
 	jsonStr, err := config.ToJSON()
@@ -255,4 +294,6 @@ func TestToJSON(t *testing.T) {
 
 	assert.Equal(t, "/db", parsed["database"])
 	assert.Equal(t, "/import", parsed["importFolder"])
+	assert.Equal(t, "/inbox", parsed["inboxFolder"])
+	assert.Equal(t, "EUR", parsed["homeCurrency"])
 }
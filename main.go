@@ -28,9 +28,10 @@ func main() {
 		println("Error initializing database:", err.Error())
 		return
 	}
+	service.HomeCurrency = config.Current.HomeCurrency
 
 	// Create an instance of the app structure, with the service
-	app := NewApp(service)
+	app := NewApp(service, config.Current.ImportPath, config.Current.InboxPath)
 
 	// Create application with options
 	err = wails.Run(&options.App{
@@ -41,7 +42,8 @@ func main() {
 			Assets: assets,
 		},
 		// BackgroundColour: &options.RGBA{R: 128, G: 38, B: 54, A: 1},
-		OnStartup: app.startup,
+		OnStartup:  app.startup,
+		OnShutdown: app.shutdown,
 		Bind: []interface{}{
 			app,
 			service,
@@ -0,0 +1,242 @@
+package models
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// DefaultHomeCurrency is the currency budgets are reported in, unless configured otherwise
+const DefaultHomeCurrency = "USD"
+
+// CurrencyAmount is an amount of money together with its currency.
+// Amounts in every currency are kept in hundredths, like cents.
+type CurrencyAmount struct {
+	Amount   Money
+	Currency string // ISO 4217 code, e.g. "EUR"
+}
+
+func (a CurrencyAmount) String() string {
+	return a.Amount.String() + " " + a.Currency
+}
+
+// String writes the cents as a decimal amount, e.g. -1234 as "-12.34"
+func (m Money) String() string {
+	sign := ""
+	if m < 0 {
+		sign, m = "-", -m
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, m/100, m%100)
+}
+
+// Convert multiplies an amount by an exchange rate, rounding half away from zero
+func (m Money) Convert(rate *big.Rat) Money {
+	r := new(big.Rat).Mul(new(big.Rat).SetInt64(int64(m)), rate)
+	q, rem := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+	// Round up when the remainder is at least half the denominator
+	if new(big.Int).Mul(new(big.Int).Abs(rem), big.NewInt(2)).Cmp(r.Denom()) >= 0 {
+		q.Add(q, big.NewInt(int64(r.Sign())))
+	}
+	return Money(q.Int64())
+}
+
+// ExchangeRate is what one unit of FromCurrency was worth in ToCurrency on a date
+type ExchangeRate struct {
+	ID           uint   `gorm:"primarykey;autoIncrement"`
+	Date         Date   `gorm:"uniqueIndex:idx_exchange_rates_date_currencies"`
+	FromCurrency string `gorm:"uniqueIndex:idx_exchange_rates_date_currencies"` // ISO 4217 code, e.g. "EUR"
+	ToCurrency   string `gorm:"uniqueIndex:idx_exchange_rates_date_currencies"`
+	Rate         string // Decimal, e.g. "1.0842", kept as text so conversions are exact
+}
+
+// rat parses the rate, which must be positive
+func (r *ExchangeRate) rat() (*big.Rat, error) {
+	rate, ok := new(big.Rat).SetString(strings.TrimSpace(r.Rate))
+	if !ok || rate.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid exchange rate %q", r.Rate)
+	}
+	return rate, nil
+}
+
+func (r *ExchangeRate) validate() error {
+	if _, err := time.Parse("2006-01-02", string(r.Date)); err != nil {
+		return fmt.Errorf("invalid date %q, expected YYYY-MM-DD", r.Date)
+	}
+	r.FromCurrency = strings.ToUpper(strings.TrimSpace(r.FromCurrency))
+	r.ToCurrency = strings.ToUpper(strings.TrimSpace(r.ToCurrency))
+	if r.FromCurrency == "" || r.ToCurrency == "" {
+		return errors.New("exchange rate needs both currencies")
+	}
+	_, err := r.rat()
+	return err
+}
+
+// --- Exchange Rates ---
+
+func (s *Service) GetExchangeRates() ([]ExchangeRate, error) {
+	return GetAll[ExchangeRate](s.DB)
+}
+
+func (s *Service) GetExchangeRatesPaginated(start, count int, sortKeys []SortOption) ([]ExchangeRate, error) {
+	orderStr := BuildOrderString(sortKeys)
+	rates, _, err := GetPage[ExchangeRate](s.DB, start, count, orderStr, nil)
+	return rates, err
+}
+
+func (s *Service) AddExchangeRate(rate *ExchangeRate) error {
+	if err := rate.validate(); err != nil {
+		return err
+	}
+	return Create(s.DB, rate)
+}
+
+func (s *Service) UpdateExchangeRate(oldRate, newRate *ExchangeRate) error {
+	if err := newRate.validate(); err != nil {
+		return err
+	}
+	return UpdateAll(s.DB, oldRate, newRate)
+}
+
+func (s *Service) DeleteExchangeRate(rate *ExchangeRate) error {
+	return Delete(s.DB, rate)
+}
+
+// LoadExchangeRates reads exchange rates from a CSV file with the header
+// Date,From,To,Rate, e.g. "2026-01-31,EUR,USD,1.0842".  A rate already in
+// the table for the same date and currencies is replaced.
+// Either every rate in the file is loaded, or none is.
+func (s *Service) LoadExchangeRates(reader io.Reader) (int, error) {
+	r := csv.NewReader(reader)
+	r.FieldsPerRecord = 4
+	if _, err := r.Read(); err != nil {
+		return 0, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	var rates []ExchangeRate
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		rate := ExchangeRate{Date: Date(strings.TrimSpace(row[0])), FromCurrency: row[1], ToCurrency: row[2], Rate: row[3]}
+		if err := rate.validate(); err != nil {
+			line, _ := r.FieldPos(0)
+			return 0, fmt.Errorf("line %d: %w", line, err)
+		}
+		rates = append(rates, rate)
+	}
+	if len(rates) == 0 {
+		return 0, nil
+	}
+
+	err := s.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "date"}, {Name: "from_currency"}, {Name: "to_currency"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rate"}),
+	}).CreateInBatches(&rates, 100).Error
+	if err != nil {
+		return 0, err
+	}
+	return len(rates), nil
+}
+
+// LoadExchangeRatesFile loads exchange rates from a CSV file, see LoadExchangeRates
+func (s *Service) LoadExchangeRatesFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	n, err := s.LoadExchangeRates(f)
+	if err != nil {
+		return "", fmt.Errorf("failed to load exchange rates from %s: %w", path, err)
+	}
+	return fmt.Sprintf("Loaded %d exchange rates.", n), nil
+}
+
+// ExchangeRateOn returns the value of one unit of from in to, using the latest
+// rate on or before date.  A rate the other way round is used inverted.
+// An empty currency is the home currency.
+func (s *Service) ExchangeRateOn(from, to string, date Date) (*big.Rat, error) {
+	from, to = s.currencyOrHome(from), s.currencyOrHome(to)
+	if from == to {
+		return big.NewRat(1, 1), nil
+	}
+
+	var rates []ExchangeRate
+	err := s.DB.Where("date <= ? AND ((from_currency = ? AND to_currency = ?) OR (from_currency = ? AND to_currency = ?))",
+		date, from, to, to, from).Order("date DESC").Limit(2).Find(&rates).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(rates) == 0 {
+		return nil, fmt.Errorf("no exchange rate from %s to %s on or before %s", from, to, date)
+	}
+	// Prefer the rate quoted the right way round when both are on the latest date
+	best := rates[0]
+	if len(rates) > 1 && rates[1].Date == best.Date && rates[1].FromCurrency == from {
+		best = rates[1]
+	}
+	rate, err := best.rat()
+	if err != nil {
+		return nil, err
+	}
+	if best.FromCurrency != from {
+		rate.Inv(rate)
+	}
+	return rate, nil
+}
+
+// Convert returns an amount in another currency, at the exchange rate on date
+func (s *Service) Convert(amount CurrencyAmount, to string, date Date) (Money, error) {
+	rate, err := s.ExchangeRateOn(amount.Currency, to, date)
+	if err != nil {
+		return 0, err
+	}
+	return amount.Amount.Convert(rate), nil
+}
+
+// currencyOrHome is the currency, or the home currency if it's empty
+func (s *Service) currencyOrHome(currency string) string {
+	if strings.TrimSpace(currency) == "" {
+		currency = s.HomeCurrency
+	}
+	if strings.TrimSpace(currency) == "" {
+		currency = DefaultHomeCurrency
+	}
+	return strings.ToUpper(strings.TrimSpace(currency))
+}
+
+// rateCache remembers exchange rates looked up for a report
+type rateCache struct {
+	s     *Service
+	to    string
+	rates map[string]*big.Rat // Keyed by currency|date
+}
+
+func (s *Service) newRateCache(to string) *rateCache {
+	return &rateCache{s: s, to: to, rates: make(map[string]*big.Rat)}
+}
+
+func (c *rateCache) convert(amount CurrencyAmount, date Date) (Money, error) {
+	key := amount.Currency + "|" + string(date)
+	rate, ok := c.rates[key]
+	if !ok {
+		var err error
+		if rate, err = c.s.ExchangeRateOn(amount.Currency, c.to, date); err != nil {
+			return 0, err
+		}
+		c.rates[key] = rate
+	}
+	return amount.Amount.Convert(rate), nil
+}
@@ -0,0 +1,135 @@
+package models
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMoney_String(t *testing.T) {
+	assert.Equal(t, "12.34", Money(1234).String())
+	assert.Equal(t, "-0.05", Money(-5).String())
+	assert.Equal(t, "0.00", Money(0).String())
+	assert.Equal(t, "-1234.50 EUR", CurrencyAmount{Amount: -123450, Currency: "EUR"}.String())
+}
+
+func TestMoney_Convert(t *testing.T) {
+	tests := []struct {
+		amount   Money
+		rate     string
+		expected Money
+	}{
+		{10000, "1.0842", 10842},
+		{1, "0.5", 1}, // Half a cent rounds away from zero
+		{-1, "0.5", -1},
+		{1, "0.49", 0},
+		{333, "1/3", 111},
+		{-12345, "0.9", -11111}, // -111.105 rounds to -111.11
+	}
+	for _, tt := range tests {
+		rate, ok := new(big.Rat).SetString(tt.rate)
+		require.True(t, ok)
+		assert.Equal(t, tt.expected, tt.amount.Convert(rate), "%d * %s", tt.amount, tt.rate)
+	}
+}
+
+func TestUpdateExchangeRate(t *testing.T) {
+	s := SetupTestService(t)
+	require.NoError(t, s.Clean())
+
+	rate := ExchangeRate{Date: "2026-01-01", FromCurrency: "EUR", ToCurrency: "USD", Rate: "1.10"}
+	require.NoError(t, s.AddExchangeRate(&rate))
+	changed := ExchangeRate{Date: "2026-01-02", FromCurrency: "gbp", ToCurrency: "USD", Rate: "1.27"}
+	require.NoError(t, s.UpdateExchangeRate(&rate, &changed))
+	assert.Error(t, s.UpdateExchangeRate(&rate, &ExchangeRate{Date: "2026-01-02", FromCurrency: "GBP", ToCurrency: "USD"}))
+
+	rates, err := s.GetExchangeRates()
+	require.NoError(t, err)
+	assert.Equal(t, []ExchangeRate{{ID: rate.ID, Date: "2026-01-02", FromCurrency: "GBP", ToCurrency: "USD", Rate: "1.27"}}, rates)
+}
+
+func TestLoadExchangeRates(t *testing.T) {
+	s := SetupTestService(t)
+	require.NoError(t, s.Clean())
+
+	n, err := s.LoadExchangeRates(strings.NewReader("Date,From,To,Rate\n" +
+		"2026-01-01,EUR,USD,1.10\n" +
+		"2026-01-15,eur,usd,1.05\n" +
+		"2026-01-31,USD,EUR,0.8\n"))
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	// Loading again replaces a rate rather than adding another
+	n, err = s.LoadExchangeRates(strings.NewReader("Date,From,To,Rate\n2026-01-15,EUR,USD,1.20\n"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	rates, err := s.GetExchangeRates()
+	require.NoError(t, err)
+	assert.Len(t, rates, 3)
+
+	// A bad row loads nothing
+	_, err = s.LoadExchangeRates(strings.NewReader("Date,From,To,Rate\n2026-02-01,EUR,USD,1.1\n2026-02-02,EUR,USD,lots\n"))
+	assert.ErrorContains(t, err, `line 3: invalid exchange rate "lots"`)
+	rates, err = s.GetExchangeRates()
+	require.NoError(t, err)
+	assert.Len(t, rates, 3)
+
+	tests := []struct {
+		from, to string
+		date     Date
+		expected string
+	}{
+		{"EUR", "USD", "2026-01-10", "11/10"}, // Latest on or before the date
+		{"EUR", "USD", "2026-01-15", "6/5"},
+		{"USD", "EUR", "2026-01-20", "5/6"}, // Inverted
+		{"EUR", "USD", "2026-02-10", "5/4"}, // The USD to EUR rate is later
+		{"EUR", "", "2026-01-10", "11/10"},  // Empty is the home currency
+		{"", "USD", "2025-01-01", "1"},
+	}
+	for _, tt := range tests {
+		rate, err := s.ExchangeRateOn(tt.from, tt.to, tt.date)
+		require.NoError(t, err)
+		assert.Equal(t, tt.expected, rate.RatString(), "%s to %s on %s", tt.from, tt.to, tt.date)
+	}
+
+	_, err = s.ExchangeRateOn("EUR", "USD", "2025-12-31")
+	assert.ErrorContains(t, err, "no exchange rate from EUR to USD on or before 2025-12-31")
+
+	amount, err := s.Convert(CurrencyAmount{Amount: 5000, Currency: "EUR"}, "USD", "2026-01-10")
+	require.NoError(t, err)
+	assert.Equal(t, Money(5500), amount)
+}
+
+func TestGetMonthlySpending_Currencies(t *testing.T) {
+	s := SetupTestService(t)
+	require.NoError(t, s.Clean())
+
+	require.NoError(t, s.AddAccount(&Account{Name: "Sparkasse", Beneficiary: "Us", Currency: "EUR"}))
+	require.NoError(t, s.AddBudget(&Budget{Name: "Groceries", Beneficiary: "Us"}))
+	_, err := s.LoadExchangeRates(strings.NewReader("Date,From,To,Rate\n2026-01-01,EUR,USD,1.10\n2026-01-20,EUR,USD,1.20\n"))
+	require.NoError(t, err)
+
+	for _, tx := range []Transaction{
+		{PostedDate: "2026-01-05", Account: "CapitalOne", Amount: 1000, Currency: "USD", Description: "KROGER", Beneficiary: "Us", Budget: "Groceries"},
+		{PostedDate: "2026-01-10", Account: "Sparkasse", Amount: 1000, Currency: "EUR", Description: "REWE", Beneficiary: "Us", Budget: "Groceries"},
+		{PostedDate: "2026-01-25", Account: "Sparkasse", Amount: 1000, Currency: "EUR", Description: "ALDI", Beneficiary: "Us", Budget: "Groceries"},
+	} {
+		require.NoError(t, s.AddTransaction(&tx))
+	}
+
+	spending, err := s.GetMonthlySpending(PostedDateBasis)
+	require.NoError(t, err)
+	assert.Equal(t, []MonthlySpending{
+		{Month: "2026-01", Budget: "Groceries", Beneficiary: "Us", Count: 3, Amount: 1000 + 1100 + 1200},
+	}, spending)
+
+	// Reported in euros instead
+	s.HomeCurrency = "eur"
+	spending, err = s.GetMonthlySpending(PostedDateBasis)
+	require.NoError(t, err)
+	require.Len(t, spending, 1)
+	assert.Equal(t, Money(909+1000+1000), spending[0].Amount) // 10 USD at 1.10
+}
@@ -32,6 +32,12 @@ func Update[T any](db *gorm.DB, item *T) error {
 	return db.Save(item).Error
 }
 
+// UpdateAll updates every column of the record old from item but its ID,
+// including the ones item leaves empty, which Updates would skip.
+func UpdateAll[T any](db *gorm.DB, old, item *T) error {
+	return db.Model(old).Select("*").Omit("id").Updates(item).Error
+}
+
 // Delete deletes a record.
 func Delete[T any](db *gorm.DB, item *T) error {
 	return db.Delete(item).Error
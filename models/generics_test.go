@@ -59,6 +59,14 @@ func TestGenerics(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, 31, fetchedUpdated.Age)
 
+	// Test UpdateAll, which clears what Updates would skip
+	err = UpdateAll(db, fetchedUpdated, &TestModel{Name: "Alice"})
+	assert.NoError(t, err)
+
+	fetchedUpdated, err = GetByID[TestModel](db, item.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, TestModel{ID: item.ID, Name: "Alice"}, *fetchedUpdated)
+
 	// Test Delete
 	err = Delete(db, item)
 	assert.NoError(t, err)
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRollbackImportBatch(t *testing.T) {
+	s := SetupTestService(t)
+	require.NoError(t, s.Clean())
+
+	good := ImportBatch{FileName: "good.csv", Account: "WfChecking"}
+	bad := ImportBatch{FileName: "wrong_account.csv", Account: "WfChecking"}
+	require.NoError(t, s.DB.Create(&good).Error)
+	require.NoError(t, s.DB.Create(&bad).Error)
+
+	// A transaction finalized from an earlier import, updated by the bad one
+	existing := Transaction{
+		PostedDate: "2025-12-01", Account: "WfChecking", Amount: 100, Description: "EXISTING",
+		Beneficiary: "Us", Budget: PLACEHOLDER_BUDGET, ImportBatchID: &good.ID, Memo: "FROM CHECKING",
+	}
+	require.NoError(t, s.AddTransaction(&existing))
+	require.NoError(t, s.DB.Create(&TransactionSplit{TransactionID: existing.ID, Budget: PLACEHOLDER_BUDGET, Beneficiary: "Us", Amount: 100}).Error)
+
+	for _, raw := range []RawTransaction{
+		{PostedDate: "2025-12-02", Account: "WfChecking", Amount: 200, Description: "GOOD", Action: "add",
+			Beneficiary: "Us", ImportBatchID: &good.ID},
+		{PostedDate: "2025-12-03", Account: "WfChecking", Amount: 300, Description: "BAD FINALIZED", Action: "add",
+			Beneficiary: "Us", Budget: PLACEHOLDER_BUDGET, ImportBatchID: &bad.ID,
+			SourceFile: "wrong_account.csv", SourceLine: 7, SourceRow: `{"0":"12/03/2025"}`},
+		{PostedDate: "2025-12-04", Account: "WfChecking", Amount: 400, Description: "BAD STAGED", Action: "add",
+			Beneficiary: "Us", ImportBatchID: &bad.ID},
+		{PostedDate: "2025-12-01", Account: "WfChecking", Amount: 100, Description: "EXISTING", Action: "update",
+			Beneficiary: "Us", Budget: PLACEHOLDER_BUDGET, ImportBatchID: &bad.ID, TransactionID: existing.ID,
+			RawHint: "Shopping", Memo: "WRONG ACCOUNT", TransactionDate: "2025-11-30",
+			ProposedSplits: `[{"Budget":"--unbudgeted--","Amount":60},{"Budget":"--unbudgeted--","Amount":40}]`},
+	} {
+		require.NoError(t, s.AddRawTransaction(&raw))
+	}
+
+	_, err := s.FinalizeImport()
+	require.NoError(t, err)
+
+	var finalized Transaction
+	require.NoError(t, s.DB.Where("description = ?", "BAD FINALIZED").First(&finalized).Error)
+	require.NotNil(t, finalized.ImportBatchID)
+	assert.Equal(t, bad.ID, *finalized.ImportBatchID)
+	assert.Equal(t, "wrong_account.csv", finalized.SourceFile)
+	assert.Equal(t, 7, finalized.SourceLine)
+	assert.Equal(t, `{"0":"12/03/2025"}`, finalized.SourceRow)
+
+	var count int64
+	require.NoError(t, s.DB.Model(&TransactionSplit{}).Where("transaction_id = ?", existing.ID).Count(&count).Error)
+	assert.Equal(t, int64(2), count)
+
+	msg, err := s.RollbackImportBatch(bad.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Rolled back import #2: removed 1 staged and 1 finalized transactions, restored 1 it changed.", msg)
+
+	raws, err := s.GetRawTransactions()
+	require.NoError(t, err)
+	require.Len(t, raws, 1)
+	assert.Equal(t, "GOOD", raws[0].Description)
+
+	txs, err := s.GetTransactions()
+	require.NoError(t, err)
+	require.Len(t, txs, 1)
+	assert.Equal(t, "EXISTING", txs[0].Description)
+	assert.Equal(t, good.ID, *txs[0].ImportBatchID)
+	assert.Equal(t, "FROM CHECKING", txs[0].Memo) // As it was before the bad import updated it
+	assert.Empty(t, txs[0].RawHint)
+	assert.Empty(t, txs[0].TransactionDate)
+	splits, err := GetAll[TransactionSplit](s.DB)
+	require.NoError(t, err)
+	require.Len(t, splits, 1)
+	assert.Equal(t, existing.ID, splits[0].TransactionID)
+	assert.Equal(t, Money(100), splits[0].Amount)
+
+	rolledBack, err := GetByID[ImportBatch](s.DB, bad.ID)
+	require.NoError(t, err)
+	assert.NotNil(t, rolledBack.RolledBack)
+
+	_, err = s.RollbackImportBatch(bad.ID)
+	assert.ErrorContains(t, err, "already rolled back")
+}
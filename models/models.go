@@ -3,9 +3,7 @@
 *
 * Models for the database.
 * Uses GORM --> WAILS to marshal between DB, Golang and JS front end.
-*
-* todo:
-*	make string match case insensitive (needs `collate nocase` in schema, but GORM doesn't?)
+* Columns text is matched on are `COLLATE NOCASE`, see migrateNoCase.
  */
 package models
 
@@ -36,6 +34,71 @@ type Account struct {
 	Description    string
 	Beneficiary    string
 	BeneficiaryObj *Beneficiary `gorm:"foreignKey:Beneficiary;references:Name" json:"-"`
+	ImportFormat   string       // Name of the ImportFormat used to read this account's downloads. *not* a foreign key, may name a built-in format
+	Currency       string       // ISO 4217 code of the account's amounts, empty for the home currency
+
+	// What tells this account's downloads apart from other accounts' in the same format
+	Number      string // Account number, or its last digits, as OFX files (ACCTID) or QIF files (!Account name) give it
+	FilePattern string // Glob matching the names the bank gives downloads, e.g. "Checking*.csv"
+}
+
+// ImportFormat describes the layout of a CSV download from a bank,
+// so that one generic parser can turn its rows into transactions.
+//
+// Columns are identified either by 0-based index ("3") or by the
+// name in the header row ("Posted Date").  An empty column means
+// the download doesn't provide that field.
+type ImportFormat struct {
+	Name                  string `gorm:"primaryKey"`
+	Description           string
+	HeaderRows            int    // Number of rows to skip before the data; the last one supplies column names
+	MinColumns            int    // Rows with fewer fields than this are rejected and listed in the import report
+	DateLayouts           string // Comma-separated Go time layouts, tried in order
+	PostedDateColumn      string
+	TransactionDateColumn string // Date of the purchase, if the bank gives it as well as the posted date
+	DescriptionColumn     string
+	RawHintColumn         string
+	AmountColumn          string // Single signed amount column, or...
+	DebitColumn           string // ...separate debit and credit columns, amount is debit - credit
+	CreditColumn          string
+	NegateAmount          bool   // Set if the bank shows expenses as negative numbers
+	ExternalIDColumn      string // Bank-supplied transaction ID, if the download has one
+	CardColumn            string // Card number, matched against the account's CardBeneficiary suffixes
+	CheckNumberColumn     string // Check number; without one it is read from descriptions like "CHECK # 1234"
+	MemoColumn            string
+	DefaultBeneficiary    string // Beneficiary when no card matches
+
+	// PDF statements have no columns.  Instead each line of their text that
+	// matches LineRegex is a transaction, with the parts in named groups:
+	// (?P<date>...), (?P<description>...), and (?P<amount>...) or (?P<debit>...) and (?P<credit>...)
+	LineRegex string
+}
+
+// Check is a check written from an account, entered in the check register
+// before it clears so that ApplyTags can give the cleared transaction its
+// payee and budget, which the bank's "CHECK # 1234" doesn't say.
+type Check struct {
+	ID          uint     `gorm:"primarykey;autoIncrement"`
+	Account     string   `gorm:"uniqueIndex:idx_checks_account_number"`
+	AccountObj  *Account `gorm:"foreignKey:Account;references:Name;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"-"`
+	Number      string   `gorm:"uniqueIndex:idx_checks_account_number"` // Leading zeros don't matter when matching
+	WrittenDate Date
+	Payee       string // Becomes the tag of the cleared transaction
+	Amount      Money  // As written, for reference
+	Budget      string // Overrides the budget the payee's tag would give; *not* a foreign key, may be left empty
+	Memo        string
+}
+
+// CardBeneficiary says who holds a card on an account, so an import can assign
+// each transaction to the beneficiary whose card made it.
+// The card number in a download must end with CardSuffix.
+type CardBeneficiary struct {
+	ID             uint     `gorm:"primarykey;autoIncrement"`
+	Account        string   `gorm:"uniqueIndex:idx_card_account_suffix"`
+	AccountObj     *Account `gorm:"foreignKey:Account;references:Name;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"-"`
+	CardSuffix     string   `gorm:"uniqueIndex:idx_card_account_suffix"` // Last digits of the card number, e.g. "3028"
+	Beneficiary    string
+	BeneficiaryObj *Beneficiary `gorm:"foreignKey:Beneficiary;references:Name" json:"-"`
 }
 
 // Budget represents a planned expenditure over time
@@ -67,47 +130,123 @@ type Budget struct {
 	BeneficiaryObj *Beneficiary `gorm:"foreignKey:Beneficiary;references:Name" json:"-"`
 	Amount         Money
 	IntervalMonths int
+	DateBasis      DateBasis // Which date of a transaction decides its budget period
 }
 
 // A financial event in an account
 type Transaction struct {
-	ID             uint       `gorm:"primarykey;autoIncrement"`
-	CreatedAt      time.Time  `json:"-"` // Hide from frontend to avoid warning/binding issues
-	UpdatedAt      time.Time  `json:"-"`
-	DeletedAt      *time.Time `gorm:"index"` // Use pointer to time for soft delete, hide from json
-	PostedDate     Date       `gorm:"column:posted_date"`
-	Account        string
-	AccountObj     *Account `gorm:"foreignKey:Account;references:Name" json:"-"`
-	Amount         Money
-	Description    string // Descriptive text as provided by the bank
-	Budget         string
-	BudgetObj      *Budget `gorm:"foreignKey:Budget;references:Name" json:"-"`
-	Beneficiary    string
-	BeneficiaryObj *Beneficiary `gorm:"foreignKey:Beneficiary;references:Name" json:"-"` // Overrides Account default if set
-	RawHint        string       // Category hint from import
+	ID              uint       `gorm:"primarykey;autoIncrement"`
+	CreatedAt       time.Time  `json:"-"` // Hide from frontend to avoid warning/binding issues
+	UpdatedAt       time.Time  `json:"-"`
+	DeletedAt       *time.Time `gorm:"index"` // Use pointer to time for soft delete, hide from json
+	PostedDate      Date       `gorm:"column:posted_date;index:idx_transactions_account_date,priority:2"`
+	TransactionDate Date       `gorm:"column:transaction_date"`                        // When the purchase was made, empty if the bank didn't say
+	Account         string     `gorm:"index:idx_transactions_account_date,priority:1"` // Imports look up an account's transactions by date
+	AccountObj      *Account   `gorm:"foreignKey:Account;references:Name" json:"-"`
+	Amount          Money
+	Currency        string // ISO 4217 code of Amount, empty for the home currency
+	Description     string // Descriptive text as provided by the bank
+	Budget          string
+	BudgetObj       *Budget `gorm:"foreignKey:Budget;references:Name" json:"-"`
+	Beneficiary     string
+	BeneficiaryObj  *Beneficiary `gorm:"foreignKey:Beneficiary;references:Name" json:"-"` // Overrides Account default if set
+	RawHint         string       // Category hint from import
+	ExternalID      string       `gorm:"index"` // Bank-supplied transaction ID (e.g. OFX FITID), empty if the download has none
+	CheckNumber     string       // Number of the check, if the transaction is one
+	Memo            string       // Memo from the bank, separate from the description
+	ImportBatchID   *uint        `gorm:"index"` // Import that created this transaction, nil if entered by hand
+	ImportBatch     *ImportBatch `gorm:"foreignKey:ImportBatchID;constraint:OnDelete:SET NULL" json:"-"`
+
+	// Where the transaction was first imported from, empty if entered by hand
+	SourceFile string // File as the user selected it
+	SourceLine int    // 1-based line in the file where the row starts
+	SourceRow  string // The row as it was in the file, as JSON (see RawTransaction)
 }
 
 // RawTransaction is used for importing transactions before they are fully processed and linked
 // No FK constraints here, to permit import of raw data
 type RawTransaction struct {
-	ID          uint       `gorm:"primarykey;autoIncrement"`
-	CreatedAt   time.Time  `json:"-"`
-	UpdatedAt   time.Time  `json:"-"`
-	DeletedAt   *time.Time `gorm:"index"`
-	PostedDate  Date       `gorm:"column:posted_date"`
+	ID              uint       `gorm:"primarykey;autoIncrement"`
+	CreatedAt       time.Time  `json:"-"`
+	UpdatedAt       time.Time  `json:"-"`
+	DeletedAt       *time.Time `gorm:"index"`
+	PostedDate      Date       `gorm:"column:posted_date;index:idx_raw_transactions_account_date,priority:2"`
+	TransactionDate Date       `gorm:"column:transaction_date"`
+	Account         string     `gorm:"index:idx_raw_transactions_account_date,priority:1"`
+	Amount          Money
+	Currency        string // ISO 4217 code of Amount, empty for the home currency
+	Description     string
+	Tag             string `gorm:"type:text COLLATE NOCASE"` // Tag, usually the normalized, stemmed Description. *not* a foreign key
+	Budget          string // *not* a foreign key so we can import garbage from CSV
+	Action          string // "add" or "update"
+	Beneficiary     string
+	RawHint         string
+	ExternalID      string `gorm:"index"` // Bank-supplied transaction ID, if any
+	CheckNumber     string // Number of the check, if the row is one
+	Memo            string
+	ProposedSplits  string // JSON array of TransactionSplits for FinalizeImport to give the transaction, see ParseProposedSplits
+
+	ImportBatchID *uint `gorm:"index"` // Import that created this row. *not* a foreign key
+	TransactionID uint  // Transaction this row updates when Action is "update"
+
+	// Where the row was last imported from, including the columns the import format doesn't use
+	SourceFile string // File as the user selected it
+	SourceLine int    // 1-based line in the file where the row starts
+	SourceRow  string // JSON object of the row's fields, keyed by CSV column header (or index, without one) or OFX element
+
+	// Probable duplicate found by fuzzy matching on import, for the user to review.
+	// At most one of the IDs is set.
+	DuplicateOfTransaction uint    // ID in transactions
+	DuplicateOfRaw         uint    // ID in raw_transactions
+	DuplicateConfidence    float64 // 0 (not a duplicate) .. 1 (certainly a duplicate)
+}
+
+// ImportBatch records one import of a downloaded file, so imported
+// transactions can be traced back to where they came from.
+type ImportBatch struct {
+	ID          uint      `gorm:"primarykey;autoIncrement"`
+	CreatedAt   time.Time // When the file was imported
+	FileName    string    // Path of the file as the user selected it
+	FileHash    string    `gorm:"index"` // SHA-256 of the file contents, hex encoded
+	ArchivePath string    // Copy of the file kept in the import history folder
 	Account     string
-	Amount      Money
-	Description string
-	Tag         string // Tag, usually derived from the Description. *not* a foreign key
-	Budget      string // *not* a foreign key so we can import garbage from CSV
-	Action      string // "add" or "update"
-	Beneficiary string
-	RawHint     string
+	Accepted    int        // Rows parsed into transactions
+	Rejected    int        // Rows the parser couldn't use
+	Added       int        // New rows in raw_transactions
+	Updated     int        // Existing rows in raw_transactions updated
+	Duplicates  int        // Rows flagged as probable duplicates
+	RolledBack  *time.Time // When the import was undone, nil if it stands
 }
 
-// Tag is a string mapped to a Budget
+// ImportChange keeps a row an import changed rather than added, as it was
+// before, so RollbackImportBatch can put it back
+type ImportChange struct {
+	ID            uint   `gorm:"primarykey;autoIncrement"`
+	ImportBatchID uint   `gorm:"index"`
+	RowTable      string // "transactions" or "raw_transactions"
+	RowID         uint
+	Before        string // The row as JSON, with a transaction's splits, see changedTransaction
+}
+
+// Tag is a rule mapping raw transactions to a Budget, and optionally a Beneficiary.
+// Its Name is matched against the transaction's tag (the stemmed description),
+// or its description or RawHint, by prefix, substring or regex.  The other
+// conditions narrow it down further, and are ignored when empty or zero.
+// Several tags may have the same Name, provided their conditions differ.
 type Tag struct {
-	Name      string `gorm:"primaryKey;default:'';constraint:OnUpdate:CASCADE,OnDelete:SET DEFAULT"`
-	Budget    string
-	BudgetObj *Budget `gorm:"foreignKey:Budget;references:Name" json:"-"`
+	ID          uint   `gorm:"primarykey;autoIncrement"`
+	Name        string `gorm:"type:text COLLATE NOCASE;default:'';uniqueIndex:idx_tags_rule,priority:1"`
+	Budget      string
+	BudgetObj   *Budget  `gorm:"foreignKey:Budget;references:Name" json:"-"`
+	Beneficiary string   // Also given to matching transactions, unless empty. *not* a foreign key
+	Field       TagField `gorm:"uniqueIndex:idx_tags_rule,priority:2"` // What Name is matched against, the tag if empty
+	Match       TagMatch `gorm:"uniqueIndex:idx_tags_rule,priority:3"` // How Name is matched, by prefix if empty
+	Priority    int      // When several tags match, the highest priority wins, then the one matching the most text
+
+	Account   string  `gorm:"uniqueIndex:idx_tags_rule,priority:4"` // Only this account's transactions
+	MinAmount Money   `gorm:"uniqueIndex:idx_tags_rule,priority:5"` // Range of the amount's size, whichever way the money went
+	MaxAmount Money   `gorm:"uniqueIndex:idx_tags_rule,priority:6"`
+	Sign      TagSign `gorm:"uniqueIndex:idx_tags_rule,priority:7"` // Only expenses, or only credits
+	MinDay    int     `gorm:"uniqueIndex:idx_tags_rule,priority:8"` // Range of days of the month the transaction posted on, e.g. 25..31
+	MaxDay    int     `gorm:"uniqueIndex:idx_tags_rule,priority:9"`
 }
@@ -0,0 +1,205 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Banks write the same merchant many ways: "WHOLE FOODS #123", "Whole Foods  Market 10234 AUSTIN TX".
+// NormalizeText reduces such text to a common form for tags to be matched against.
+
+var (
+	// referenceSuffix is a store or reference number at the end of the text, e.g. "#123", "store 42", "ref 8a7b", "10234"
+	referenceSuffix = regexp.MustCompile(`\s+(?:#\s*\w[\w-]*|(?:store|str|ref|no\.?)\s*#?\s*\d[\w-]*|\d{3,}[\d-]*)$`)
+
+	// usStates are the postal codes that end a card transaction's city and state
+	usStates = wordSet("al ak az ar ca co ct de dc fl ga hi id il in ia ks ky la me md ma mi mn ms mo mt ne nv nh nj nm ny nc nd oh ok or pa ri sc sd tn tx ut vt va wa wv wi wy")
+
+	// ambiguousStates are the postal codes that are also words or company
+	// suffixes, as in "PAY WHAT YOU CAN OR" or "ACME SAN JOSE CO", so are only
+	// taken for a state where the city follows a store or reference number
+	ambiguousStates = wordSet("co de hi in me ok or")
+
+	// referenceWord is a store or reference number on its own, e.g. "#123", "10234"
+	referenceWord = regexp.MustCompile(`^(?:#\w[\w-]*|\d{3,}[\d-]*)$`)
+
+	// cityPrefixes start the two-word city names common enough to strip whole, e.g. "san jose"
+	cityPrefixes = wordSet("el fort ft las los new north port saint salt san santa south st west east")
+)
+
+func wordSet(words string) map[string]bool {
+	set := map[string]bool{}
+	for _, w := range strings.Fields(words) {
+		set[w] = true
+	}
+	return set
+}
+
+// foldText lower-cases text and collapses its runs of whitespace to single spaces
+func foldText(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+}
+
+// NormalizeText folds case and whitespace, then strips trailing store and
+// reference numbers and a trailing "city ST", so "WHOLE FOODS  #123 AUSTIN TX"
+// becomes "whole foods".  Something is always left of the merchant's name.
+func NormalizeText(s string) string {
+	s = foldText(s)
+	for {
+		stripped := stripCityState(referenceSuffix.ReplaceAllString(s, ""))
+		if stripped == s || stripped == "" {
+			return s
+		}
+		s = stripped
+	}
+}
+
+// stripCityState removes a trailing state code and the city before it,
+// provided at least one word is left, see ambiguousStates
+func stripCityState(s string) string {
+	words := strings.Split(s, " ")
+	n := len(words)
+	state := words[n-1]
+	if n < 3 || !usStates[state] {
+		return s
+	}
+	n -= 2
+	if n >= 2 && cityPrefixes[words[n-1]] {
+		n--
+	}
+	if ambiguousStates[state] && (n < 2 || !referenceWord.MatchString(words[n-1])) {
+		return s
+	}
+	return strings.Join(words[:n], " ")
+}
+
+// migrateTagIDs gives the tags of a database from when a tag's Name was its
+// key the IDs that let rules share a name.  SQLite can't add a key to a table,
+// so the tags are copied into a new one, its Name NOCASE as migrateNoCase
+// would make it.  Tags that differ only in case are left to normalizeTagData,
+// but where the new table's index takes only the first of them, the others are
+// returned for the user to see they're gone.
+func migrateTagIDs(db *gorm.DB) ([]string, error) {
+	if !db.Migrator().HasTable(&Tag{}) || db.Migrator().HasColumn(&Tag{}, "ID") {
+		return nil, nil
+	}
+	var notes []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Migrator().RenameTable("tags", "tags_by_name"); err != nil {
+			return err
+		}
+		if err := tx.Migrator().CreateTable(&Tag{}); err != nil {
+			return err
+		}
+		var columns []string
+		if err := tx.Raw("SELECT name FROM pragma_table_info('tags_by_name')").Scan(&columns).Error; err != nil {
+			return err
+		}
+		list := "`" + strings.Join(columns, "`, `") + "`"
+		copyTags := "INSERT OR IGNORE INTO tags (" + list + ") SELECT " + list + " FROM tags_by_name ORDER BY name"
+		if err := tx.Exec(copyTags).Error; err != nil {
+			return err
+		}
+
+		var dropped []Tag
+		err := tx.Table("tags_by_name").Where("name COLLATE BINARY NOT IN (SELECT name FROM tags)").Order("name").Find(&dropped).Error
+		if err != nil {
+			return err
+		}
+		for _, t := range dropped {
+			notes = append(notes, fmt.Sprintf("Tag %q for %s was dropped: tags now ignore case, and another has the same name", t.Name, t.Budget))
+		}
+		return tx.Migrator().DropTable("tags_by_name")
+	})
+	return notes, err
+}
+
+// noCaseColumns are the columns tags are looked up by, see NormalizeText.
+// migrateTagIDs gives tags.name its collation.
+var noCaseColumns = []struct {
+	model any
+	field string
+}{
+	{&RawTransaction{}, "Tag"},
+}
+
+// migrateNoCase gives an existing database's tag columns NOCASE collation,
+// reporting whether it did so the tags can be normalized too
+func migrateNoCase(db *gorm.DB) (bool, error) {
+	var ddl string
+	err := db.Raw("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?", "raw_transactions").Scan(&ddl).Error
+	if err != nil || ddl == "" || strings.Contains(strings.ToUpper(ddl), "COLLATE NOCASE") {
+		return false, err
+	}
+	for _, c := range noCaseColumns {
+		if !db.Migrator().HasColumn(c.model, c.field) {
+			continue
+		}
+		if err := db.Migrator().AlterColumn(c.model, c.field); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// normalizeTagData normalizes the tags saved before NormalizeText existed.
+// Where tags normalize to the same rule, one takes the normalized name and the
+// others keep theirs, so no rule is lost, though they won't match until the
+// user changes them.  A tag that differs from the one taking its rule only in
+// case can't keep its name, so is merged into it.  Either is returned for the
+// user to see.  A tag whose name is already normalized can't step aside, so
+// takes its rule first, then the tag with the highest priority, then the first
+// by name.
+func normalizeTagData(db *gorm.DB) ([]string, error) {
+	var notes []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var tags []Tag
+		if err := tx.Order("priority DESC, name, id").Find(&tags).Error; err != nil {
+			return err
+		}
+		sort.SliceStable(tags, func(i, j int) bool { return tags[i].isNormalized() && !tags[j].isNormalized() })
+
+		taken := map[Tag]Tag{} // The tag given each rule, by the rule without what it gives
+		for _, t := range tags {
+			old := t.Name
+			t.normalize()
+			rule := t
+			rule.ID, rule.Name, rule.Budget, rule.Beneficiary, rule.Priority = 0, strings.ToLower(t.Name), "", "", 0
+			if other, ok := taken[rule]; ok {
+				if !strings.EqualFold(old, t.Name) {
+					notes = append(notes, fmt.Sprintf("Tag %q keeps its name, as %q does what it would become; it won't match until it's changed", old, other.Name))
+					continue
+				}
+				if err := tx.Delete(&Tag{}, t.ID).Error; err != nil {
+					return err
+				}
+				notes = append(notes, fmt.Sprintf("Tag %q for %s was merged into %q for %s, as tags now ignore case", old, t.Budget, other.Name, other.Budget))
+				continue
+			}
+			taken[rule] = t
+			if t.Name != old {
+				if err := tx.Model(&Tag{}).Where("id = ?", t.ID).Update("name", t.Name).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		var raws []RawTransaction
+		if err := tx.Select("id", "tag").Find(&raws).Error; err != nil {
+			return err
+		}
+		for _, raw := range raws {
+			if tag := NormalizeText(raw.Tag); tag != raw.Tag {
+				if err := tx.Model(&RawTransaction{}).Where("id = ?", raw.ID).Update("tag", tag).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	return notes, err
+}
@@ -0,0 +1,147 @@
+package models
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestNormalizeText(t *testing.T) {
+	tests := []struct{ text, expected string }{
+		{"WHOLE FOODS #123", "whole foods"},
+		{"Whole  Foods\tMarket 10234 AUSTIN TX", "whole foods market"},
+		{"SHELL OIL 57444 SAN JOSE CA", "shell oil"},
+		{"TARGET STORE 0042", "target"},
+		{"Netflix.com REF # 8812", "netflix.com"},
+		{"7-ELEVEN 35012", "7-eleven"},
+		{"ROUTE 66 DINER", "route 66 diner"},           // Numbers mid-name stay
+		{"ACME CO", "acme co"},                         // Too short to have a city
+		{"PAY WHAT YOU CAN OR", "pay what you can or"}, // States that are also words need a number before the city
+		{"ACME SAN JOSE CO", "acme san jose co"},
+		{"SAY HI", "say hi"},
+		{"GOOD TO GO IN", "good to go in"},
+		{"KING SOOPERS #12 DENVER CO", "king soopers"},
+		{"SHELL OIL 57444 PORTLAND OR", "shell oil"},
+		{"#123", "#123"},
+		{"  ", ""},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, NormalizeText(tt.text), tt.text)
+	}
+}
+
+func TestApplyTags_IgnoresCase(t *testing.T) {
+	s := SetupTestService(t)
+	require.NoError(t, s.Clean())
+	require.NoError(t, s.AddBudget(&Budget{Name: "Groceries", Beneficiary: "Us"}))
+	require.NoError(t, s.AddBudget(&Budget{Name: "Fuel", Beneficiary: "Us"}))
+
+	tag := Tag{Name: "Whole Foods #88", Budget: "Groceries"}
+	require.NoError(t, s.AddTag(&tag))
+	assert.Equal(t, "whole foods", tag.Name)
+	assert.Error(t, s.AddTag(&Tag{Name: "WHOLE FOODS", Budget: "Groceries"})) // Same tag under NOCASE
+	require.NoError(t, s.AddTag(&Tag{Name: `^shell\b`, Match: TagMatchRegex, Budget: "Fuel"}))
+
+	for _, raw := range []RawTransaction{
+		{PostedDate: "2026-03-01", Account: "WfVisa", Amount: 5000, Description: "WHOLE FOODS MKT 10234 AUSTIN TX"},
+		{PostedDate: "2026-03-02", Account: "WfVisa", Amount: 4000, Description: "Shell Oil 57444"},
+	} {
+		require.NoError(t, s.AddRawTransaction(&raw))
+	}
+	_, err := s.ApplyTags()
+	require.NoError(t, err)
+
+	raws, err := s.GetRawTransactions()
+	require.NoError(t, err)
+	require.Len(t, raws, 2)
+	assert.Equal(t, [2]string{"whole foods mkt", "Groceries"}, [2]string{raws[0].Tag, raws[0].Budget})
+	assert.Equal(t, [2]string{"shell oil", "Fuel"}, [2]string{raws[1].Tag, raws[1].Budget})
+
+	var count int64
+	require.NoError(t, s.DB.Model(&RawTransaction{}).Where("tag = ?", "WHOLE FOODS MKT").Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+}
+
+// legacyTag and legacyRawTransaction are the tables as they were before NOCASE,
+// when a tag's Name was its key
+type legacyTag struct {
+	Name      string `gorm:"primaryKey;default:'';constraint:OnUpdate:CASCADE,OnDelete:SET DEFAULT"`
+	Budget    string
+	BudgetObj *Budget `gorm:"foreignKey:Budget;references:Name"`
+}
+
+func (legacyTag) TableName() string { return "tags" }
+
+type legacyRawTransaction struct {
+	ID          uint `gorm:"primarykey;autoIncrement"`
+	Description string
+	Tag         string
+}
+
+func (legacyRawTransaction) TableName() string { return "raw_transactions" }
+
+func TestNewService_MigratesNoCase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "budget.db")
+	db, err := gorm.Open(sqlite.Open(path+"?_foreign_keys=on"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&Beneficiary{}, &Budget{}, &legacyTag{}, &legacyRawTransaction{}))
+	require.NoError(t, db.Create(&Beneficiary{Name: "Us"}).Error)
+	for _, name := range []string{"Groceries", "Shopping"} {
+		require.NoError(t, db.Create(&Budget{Name: name, Beneficiary: "Us"}).Error)
+	}
+	for _, tag := range []legacyTag{
+		{Name: "Kroger", Budget: "Groceries"}, {Name: "KROGER #12", Budget: "Shopping"}, {Name: "kroger", Budget: "Shopping"},
+		{Name: "Whole Foods #12", Budget: "Shopping"}, {Name: "Whole Foods", Budget: "Groceries"},
+	} {
+		require.NoError(t, db.Create(&tag).Error)
+	}
+	require.NoError(t, db.Create(&legacyRawTransaction{Description: "WHOLE FOODS #5", Tag: "WHOLE FOODS #5"}).Error)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	require.NoError(t, sqlDB.Close())
+
+	s, err := NewService(path)
+	require.NoError(t, err)
+	tags, err := s.GetTags()
+	require.NoError(t, err)
+	require.Len(t, tags, 4)
+	budgets := map[string]string{}
+	for _, tag := range tags {
+		assert.NotZero(t, tag.ID)
+		budgets[tag.Name] = tag.Budget
+	}
+	// A tag already normalized keeps its rule, the others their names, "Kroger" sorting before "kroger"
+	assert.Equal(t, map[string]string{
+		"kroger": "Groceries", "KROGER #12": "Shopping", "whole foods": "Groceries", "Whole Foods #12": "Shopping",
+	}, budgets)
+	assert.Equal(t, []string{
+		`Tag "kroger" for Shopping was merged into "kroger" for Groceries, as tags now ignore case`,
+		`Tag "KROGER #12" keeps its name, as "kroger" does what it would become; it won't match until it's changed`,
+		`Tag "Whole Foods #12" keeps its name, as "whole foods" does what it would become; it won't match until it's changed`,
+	}, s.UpgradeNotes)
+	require.NoError(t, s.AddTag(&Tag{Name: "kroger", Budget: "Shopping", Account: "WfVisa"})) // Rules may now share a name
+
+	raws, err := s.GetRawTransactions()
+	require.NoError(t, err)
+	require.Len(t, raws, 1)
+	assert.Equal(t, "whole foods", raws[0].Tag)
+
+	var ddl string
+	require.NoError(t, s.DB.Raw("SELECT sql FROM sqlite_master WHERE name = 'raw_transactions'").Scan(&ddl).Error)
+	assert.Contains(t, ddl, "`tag` text COLLATE NOCASE")
+	assert.True(t, s.DB.Migrator().HasIndex(&RawTransaction{}, "ExternalID")) // Rebuilt after altering the table
+
+	require.NoError(t, s.DB.Raw("SELECT sql FROM sqlite_master WHERE name = 'tags'").Scan(&ddl).Error)
+	assert.Contains(t, ddl, "`name` text COLLATE NOCASE")
+
+	// Once migrated, tags are left alone
+	require.NoError(t, s.DB.Exec("INSERT INTO tags (name, budget) VALUES ('Target', 'Shopping')").Error)
+	s, err = NewService(path)
+	require.NoError(t, err)
+	var tag Tag
+	assert.NoError(t, s.DB.Where("name = ? COLLATE BINARY", "Target").First(&tag).Error)
+}
@@ -0,0 +1,91 @@
+package models
+
+import "fmt"
+
+// DateBasis says which date of a transaction decides the period it belongs to.
+// A purchase on the 31st that posts on the 2nd is in one month by its
+// transaction date and the next by its posted date.
+type DateBasis string
+
+const (
+	PostedDateBasis      DateBasis = "posted"      // The date the bank posted it, which every transaction has
+	TransactionDateBasis DateBasis = "transaction" // The date of the purchase, falling back to the posted date if unknown
+)
+
+// MonthlySpending is the total of a budget's transactions for one beneficiary in one month
+type MonthlySpending struct {
+	Month       string // YYYY-MM
+	Budget      string
+	Beneficiary string
+	Count       int
+	Amount      Money // In the home currency
+}
+
+// GetMonthlySpending totals transactions by month, budget and beneficiary.
+// A split transaction is counted in the budget of each of its splits.
+// basis says which date puts a transaction in a month; empty means use each budget's own DateBasis.
+// Amounts in other currencies are converted to the home currency at the rate on that same date.
+func (s *Service) GetMonthlySpending(basis DateBasis) ([]MonthlySpending, error) {
+	switch basis {
+	case "", PostedDateBasis, TransactionDateBasis:
+	default:
+		return nil, fmt.Errorf("unknown date basis %q", basis)
+	}
+
+	// Totals for each day and currency, to be converted then added up by month
+	var days []struct {
+		Date        Date
+		Budget      string
+		Beneficiary string
+		Currency    string
+		Count       int
+		Amount      Money
+	}
+	err := s.DB.Raw(`
+		SELECT d.date, d.budget, d.beneficiary, d.currency, count(*) AS count, sum(d.amount) AS amount
+		FROM (
+			SELECT CASE
+					WHEN (? = 'transaction' OR (? = '' AND b.date_basis = 'transaction')) AND t.transaction_date != ''
+					THEN t.transaction_date
+					ELSE t.posted_date
+				END AS date,
+				t.budget, t.beneficiary, t.currency, t.amount
+			FROM (
+				-- A split transaction counts as its splits, each in its own budget
+				SELECT t.posted_date, t.transaction_date, t.currency,
+					coalesce(sp.budget, t.budget) AS budget,
+					coalesce(nullif(sp.beneficiary, ''), t.beneficiary) AS beneficiary,
+					coalesce(sp.amount, t.amount) AS amount
+				FROM transactions t
+					LEFT JOIN transaction_splits sp ON sp.transaction_id = t.id
+				WHERE t.deleted_at IS NULL
+			) t
+				LEFT JOIN budgets b ON b.name = t.budget
+		) d
+		GROUP BY d.date, d.budget, d.beneficiary, d.currency
+		ORDER BY strftime('%Y-%m', d.date), d.budget, d.beneficiary, d.date, d.currency`, basis, basis).
+		Scan(&days).Error
+	if err != nil {
+		return nil, err
+	}
+
+	rates := s.newRateCache(s.currencyOrHome(""))
+	var spending []MonthlySpending
+	for _, d := range days {
+		amount, err := rates.convert(CurrencyAmount{Amount: d.Amount, Currency: d.Currency}, d.Date)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %w", d.Date, d.Budget, err)
+		}
+		month := string(d.Date)[:min(7, len(d.Date))]
+		if n := len(spending); n > 0 && spending[n-1].Month == month &&
+			spending[n-1].Budget == d.Budget && spending[n-1].Beneficiary == d.Beneficiary {
+			spending[n-1].Count += d.Count
+			spending[n-1].Amount += amount
+			continue
+		}
+		spending = append(spending, MonthlySpending{
+			Month: month, Budget: d.Budget, Beneficiary: d.Beneficiary, Count: d.Count, Amount: amount,
+		})
+	}
+	return spending, nil
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetMonthlySpending(t *testing.T) {
+	s := SetupTestService(t)
+	require.NoError(t, s.Clean())
+
+	require.NoError(t, s.AddBudget(&Budget{Name: "Groceries", Beneficiary: "Us", DateBasis: TransactionDateBasis}))
+	require.NoError(t, s.AddBudget(&Budget{Name: "Rent", Beneficiary: "Us", DateBasis: PostedDateBasis}))
+
+	// Bought on the last day of the month, posted in the next
+	for _, tx := range []Transaction{
+		{PostedDate: "2026-02-02", TransactionDate: "2026-01-31", Account: "CapitalOne", Amount: 5000,
+			Description: "KROGER", Beneficiary: "Us", Budget: "Groceries"},
+		{PostedDate: "2026-02-02", TransactionDate: "2026-01-31", Account: "WfChecking", Amount: 150000,
+			Description: "RENT", Beneficiary: "Us", Budget: "Rent"},
+		{PostedDate: "2026-02-10", Account: "CapitalOne", Amount: 2500,
+			Description: "NO PURCHASE DATE", Beneficiary: "Us", Budget: "Groceries"},
+	} {
+		require.NoError(t, s.AddTransaction(&tx))
+	}
+
+	tests := []struct {
+		basis    DateBasis
+		expected []MonthlySpending
+	}{
+		{PostedDateBasis, []MonthlySpending{
+			{Month: "2026-02", Budget: "Groceries", Beneficiary: "Us", Count: 2, Amount: 7500},
+			{Month: "2026-02", Budget: "Rent", Beneficiary: "Us", Count: 1, Amount: 150000},
+		}},
+		{TransactionDateBasis, []MonthlySpending{
+			{Month: "2026-01", Budget: "Groceries", Beneficiary: "Us", Count: 1, Amount: 5000},
+			{Month: "2026-01", Budget: "Rent", Beneficiary: "Us", Count: 1, Amount: 150000},
+			{Month: "2026-02", Budget: "Groceries", Beneficiary: "Us", Count: 1, Amount: 2500},
+		}},
+		{"", []MonthlySpending{ // Each budget's own basis
+			{Month: "2026-01", Budget: "Groceries", Beneficiary: "Us", Count: 1, Amount: 5000},
+			{Month: "2026-02", Budget: "Groceries", Beneficiary: "Us", Count: 1, Amount: 2500},
+			{Month: "2026-02", Budget: "Rent", Beneficiary: "Us", Count: 1, Amount: 150000},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.basis), func(t *testing.T) {
+			spending, err := s.GetMonthlySpending(tt.basis)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, spending)
+		})
+	}
+
+	_, err := s.GetMonthlySpending("weekly")
+	assert.ErrorContains(t, err, "unknown date basis")
+}
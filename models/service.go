@@ -1,23 +1,48 @@
 package models
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
 type Service struct {
-	DB *gorm.DB
+	DB           *gorm.DB
+	HomeCurrency string   // Currency that reports convert amounts to, DefaultHomeCurrency unless configured
+	UpgradeNotes []string // What upgrading the database changed that the user should know of, e.g. tags that couldn't keep their names
 }
 
 var allTables = []any{
 	&Beneficiary{},
+	&ImportFormat{},
 	&Account{},
+	&CardBeneficiary{},
+	&Check{},
 	&Budget{},
 	&Tag{},
+	&ImportBatch{},
+	&ImportChange{},
 	&Transaction{},
+	&TransactionSplit{},
 	&RawTransaction{},
+	&ExchangeRate{},
+	&StemRule{},
+}
+
+// builtInTable holds what used to be built in, see NewService
+type builtInTable struct {
+	model any
+	name  string
+	seed  func(*Service) error
+}
+
+var builtInTables = []builtInTable{
+	{&StemRule{}, "stem rules", (*Service).seedStemRules},
+	{&CardBeneficiary{}, "card beneficiaries", (*Service).seedCardBeneficiaries},
 }
 
 func NewService(dbPath string) (*Service, error) {
@@ -26,13 +51,56 @@ func NewService(dbPath string) (*Service, error) {
 		return nil, err
 	}
 
+	// Tables for what used to be built in are seeded with the defaults once
+	// created, if the database predates them
+	var newTables []builtInTable
+	for _, t := range builtInTables {
+		if !db.Migrator().HasTable(t.model) {
+			newTables = append(newTables, t)
+		}
+	}
+
+	// Accounts used to be told apart by download format alone
+	newFilePatterns := !db.Migrator().HasColumn(&Account{}, "FilePattern")
+
+	// Tags used to be keyed by Name, which kept rules from sharing a name
+	upgradeNotes, err := migrateTagIDs(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to give tags IDs: %w", err)
+	}
+
+	// Tags used to be matched with case, so a database that predates that gets
+	// NOCASE columns before AutoMigrate, which restores the indexes altering drops
+	normalizeTags, err := migrateNoCase(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make tag columns case-insensitive: %w", err)
+	}
+
 	// Auto Migrate
 	err = db.AutoMigrate(allTables...)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Service{DB: db}, nil
+	s := &Service{DB: db, HomeCurrency: DefaultHomeCurrency, UpgradeNotes: upgradeNotes}
+	for _, t := range newTables {
+		if err := t.seed(s); err != nil {
+			return nil, fmt.Errorf("failed to seed %s: %w", t.name, err)
+		}
+	}
+	if newFilePatterns {
+		if err := s.seedFilePatterns(); err != nil {
+			return nil, fmt.Errorf("failed to seed account file patterns: %w", err)
+		}
+	}
+	if normalizeTags {
+		notes, err := normalizeTagData(db)
+		if err != nil {
+			return nil, fmt.Errorf("failed to normalize tags: %w", err)
+		}
+		s.UpgradeNotes = append(s.UpgradeNotes, notes...)
+	}
+	return s, nil
 }
 
 // Clean drops all tables and re-migrates them, then seeds production data
@@ -83,24 +151,35 @@ func (s *Service) seed() error {
 	// Seed Accounts
 	err = seedTable(s, []Account{
 		{
-			Name:        "CapitalOne",
-			Description: "Capital One rewards Credit Account",
-			Beneficiary: "Us",
+			Name:         "CapitalOne",
+			Description:  "Capital One rewards Credit Account",
+			Beneficiary:  "Us",
+			ImportFormat: "CapitalOne",
 		},
 		{
-			Name:        "WfChecking",
-			Description: "Wells Fargo checking",
-			Beneficiary: "Us",
+			Name:         "WfChecking",
+			Description:  "Wells Fargo checking",
+			Beneficiary:  "Us",
+			ImportFormat: "WfChecking",
 		},
 		{
-			Name:        "WfVisa",
-			Description: "Wells Fargo Visa",
-			Beneficiary: "Us",
+			Name:         "WfVisa",
+			Description:  "Wells Fargo Visa",
+			Beneficiary:  "Us",
+			ImportFormat: "WfVisa",
 		},
 	})
 	if err != nil {
 		return fmt.Errorf("failed to seed accounts: %w", err)
 	}
+	if err := s.seedFilePatterns(); err != nil {
+		return fmt.Errorf("failed to seed account file patterns: %w", err)
+	}
+
+	// Seed card holders
+	if err := s.seedCardBeneficiaries(); err != nil {
+		return fmt.Errorf("failed to seed card beneficiaries: %w", err)
+	}
 
 	// Seed Budgets
 	err = seedTable(s, []Budget{
@@ -125,6 +204,54 @@ func (s *Service) seed() error {
 		return fmt.Errorf("failed to seed tags: %w", err)
 	}
 
+	if err := s.seedStemRules(); err != nil {
+		return fmt.Errorf("failed to seed stem rules: %w", err)
+	}
+
+	return nil
+}
+
+// defaultCardBeneficiaries are who holds each of the default CapitalOne account's cards
+var defaultCardBeneficiaries = []CardBeneficiary{
+	{Account: "CapitalOne", CardSuffix: "3028", Beneficiary: "Bob"},
+	{Account: "CapitalOne", CardSuffix: "6539", Beneficiary: "Jessie"},
+}
+
+// seedCardBeneficiaries adds the default card holders whose account and beneficiary exist
+func (s *Service) seedCardBeneficiaries() error {
+	for _, card := range defaultCardBeneficiaries {
+		var accounts, beneficiaries int64
+		if err := s.DB.Model(&Account{}).Where("name = ?", card.Account).Count(&accounts).Error; err != nil {
+			return err
+		}
+		if err := s.DB.Model(&Beneficiary{}).Where("name = ?", card.Beneficiary).Count(&beneficiaries).Error; err != nil {
+			return err
+		}
+		if accounts == 0 || beneficiaries == 0 {
+			continue
+		}
+		if err := Create(s.DB, &card); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// defaultFilePatterns are the names Wells Fargo gives downloads, whose CSV
+// layout is the same for checking and credit card accounts
+var defaultFilePatterns = map[string]string{
+	"WfChecking": "Checking*.csv",
+	"WfVisa":     "CreditCard*.csv",
+}
+
+// seedFilePatterns gives the default accounts their file patterns, if they don't have one
+func (s *Service) seedFilePatterns() error {
+	for account, pattern := range defaultFilePatterns {
+		err := s.DB.Model(&Account{}).Where("name = ? AND coalesce(file_pattern, '') = ''", account).Update("file_pattern", pattern).Error
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -172,13 +299,85 @@ func (s *Service) AddAccount(account *Account) error {
 }
 
 func (s *Service) UpdateAccount(oldAccount, newAccount *Account) error {
-	return s.DB.Model(oldAccount).Updates(newAccount).Error
+	return UpdateAll(s.DB, oldAccount, newAccount)
 }
 
 func (s *Service) DeleteAccount(account *Account) error {
 	return Delete(s.DB, account)
 }
 
+// --- Import Formats ---
+
+func (s *Service) GetImportFormats() ([]ImportFormat, error) {
+	return GetAll[ImportFormat](s.DB)
+}
+
+func (s *Service) GetImportFormatsPaginated(start, count int, sortKeys []SortOption) ([]ImportFormat, error) {
+	orderStr := BuildOrderString(sortKeys)
+	formats, _, err := GetPage[ImportFormat](s.DB, start, count, orderStr, nil)
+	return formats, err
+}
+
+func (s *Service) AddImportFormat(format *ImportFormat) error {
+	return Create(s.DB, format)
+}
+
+func (s *Service) UpdateImportFormat(oldFormat, newFormat *ImportFormat) error {
+	return UpdateAll(s.DB, oldFormat, newFormat)
+}
+
+func (s *Service) DeleteImportFormat(format *ImportFormat) error {
+	return Delete(s.DB, format)
+}
+
+// --- Card Beneficiaries ---
+
+func (s *Service) GetCardBeneficiaries() ([]CardBeneficiary, error) {
+	return GetAll[CardBeneficiary](s.DB)
+}
+
+func (s *Service) GetCardBeneficiariesPaginated(start, count int, sortKeys []SortOption) ([]CardBeneficiary, error) {
+	orderStr := BuildOrderString(sortKeys)
+	cards, _, err := GetPage[CardBeneficiary](s.DB, start, count, orderStr, nil)
+	return cards, err
+}
+
+func (s *Service) AddCardBeneficiary(card *CardBeneficiary) error {
+	return Create(s.DB, card)
+}
+
+func (s *Service) UpdateCardBeneficiary(oldCard, newCard *CardBeneficiary) error {
+	return UpdateAll(s.DB, oldCard, newCard)
+}
+
+func (s *Service) DeleteCardBeneficiary(card *CardBeneficiary) error {
+	return Delete(s.DB, card)
+}
+
+// --- Check Register ---
+
+func (s *Service) GetChecks() ([]Check, error) {
+	return GetAll[Check](s.DB)
+}
+
+func (s *Service) GetChecksPaginated(start, count int, sortKeys []SortOption) ([]Check, error) {
+	orderStr := BuildOrderString(sortKeys)
+	checks, _, err := GetPage[Check](s.DB, start, count, orderStr, nil)
+	return checks, err
+}
+
+func (s *Service) AddCheck(check *Check) error {
+	return Create(s.DB, check)
+}
+
+func (s *Service) UpdateCheck(oldCheck, newCheck *Check) error {
+	return UpdateAll(s.DB, oldCheck, newCheck)
+}
+
+func (s *Service) DeleteCheck(check *Check) error {
+	return Delete(s.DB, check)
+}
+
 // --- Budgets ---
 
 func (s *Service) GetBudgets() ([]Budget, error) {
@@ -216,11 +415,19 @@ func (s *Service) GetTagsPaginated(start, count int, sortKeys []SortOption) ([]T
 }
 
 func (s *Service) AddTag(Tag *Tag) error {
+	Tag.normalize()
+	if _, err := Tag.compile(); err != nil {
+		return err
+	}
 	return Create(s.DB, Tag)
 }
 
 func (s *Service) UpdateTag(oldTag, newTag *Tag) error {
-	return s.DB.Model(oldTag).Updates(newTag).Error
+	newTag.normalize()
+	if _, err := newTag.compile(); err != nil {
+		return err
+	}
+	return UpdateAll(s.DB, oldTag, newTag)
 }
 
 func (s *Service) DeleteTag(Tag *Tag) error {
@@ -243,7 +450,18 @@ func (s *Service) AddTransaction(transaction *Transaction) error {
 	return Create(s.DB, transaction)
 }
 
+// UpdateTransaction refuses to change the amount of a split transaction,
+// since its splits would no longer add up; change the splits with it instead.
 func (s *Service) UpdateTransaction(oldTransaction, newTransaction *Transaction) error {
+	if newTransaction.Amount != 0 && newTransaction.Amount != oldTransaction.Amount {
+		split, err := hasSplits(s.DB, oldTransaction.ID)
+		if err != nil {
+			return err
+		}
+		if split {
+			return errors.New("the transaction is split, clear its splits before changing its amount")
+		}
+	}
 	return s.DB.Model(oldTransaction).Updates(newTransaction).Error
 }
 
@@ -280,149 +498,380 @@ func (s *Service) DeleteRawTransaction(rawTransaction *RawTransaction) error {
 	return Delete(s.DB, rawTransaction)
 }
 
-func (s *Service) FinalizeImport() (string, error) {
+// --- Import Batches ---
+
+func (s *Service) GetImportBatches() ([]ImportBatch, error) {
+	return GetAll[ImportBatch](s.DB)
+}
+
+func (s *Service) GetImportBatchesPaginated(start, count int, sortKeys []SortOption) ([]ImportBatch, error) {
+	orderStr := BuildOrderString(sortKeys)
+	batches, _, err := GetPage[ImportBatch](s.DB, start, count, orderStr, nil)
+	return batches, err
+}
+
+// RollbackImportBatch undoes an import: it deletes the rows the import added
+// to staging and any transactions finalized from them, puts back the rows it
+// changed (see RecordImportChange) that are still there, and marks the batch
+// rolled back.
+func (s *Service) RollbackImportBatch(id uint) (string, error) {
+	var staged, finalized, restored int64
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var batch ImportBatch
+		if err := tx.First(&batch, id).Error; err != nil {
+			return err
+		}
+		if batch.RolledBack != nil {
+			return fmt.Errorf("import #%d was already rolled back", id)
+		}
+
+		result := tx.Where("import_batch_id = ?", id).Delete(&RawTransaction{})
+		if result.Error != nil {
+			return result.Error
+		}
+		staged = result.RowsAffected
+
+		result = tx.Where("import_batch_id = ?", id).Delete(&Transaction{})
+		if result.Error != nil {
+			return result.Error
+		}
+		finalized = result.RowsAffected
+
+		// Latest first, so a row changed twice ends up as it was before the first change
+		var changes []ImportChange
+		if err := tx.Where("import_batch_id = ?", id).Order("id DESC").Find(&changes).Error; err != nil {
+			return err
+		}
+		for _, change := range changes {
+			ok, err := change.restore(tx)
+			if err != nil {
+				return fmt.Errorf("restoring %s #%d: %w", change.RowTable, change.RowID, err)
+			}
+			if ok {
+				restored++
+			}
+		}
+		if err := tx.Where("import_batch_id = ?", id).Delete(&ImportChange{}).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		batch.RolledBack = &now
+		return tx.Save(&batch).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Rolled back import #%d: removed %d staged and %d finalized transactions, restored %d it changed.",
+		id, staged, finalized, restored), nil
+}
+
+// changedTransaction is a transaction as ImportChange keeps it
+type changedTransaction struct {
+	Transaction Transaction
+	Splits      []TransactionSplit
+}
+
+// RecordImportChange keeps row, a *Transaction or *RawTransaction, as it is
+// before the import batchID changes it.  Call it before saving the change.
+func RecordImportChange(tx *gorm.DB, batchID uint, row any) error {
+	change := ImportChange{ImportBatchID: batchID}
+	var before any
+	switch r := row.(type) {
+	case *Transaction:
+		t := changedTransaction{Transaction: *r}
+		if err := tx.Where("transaction_id = ?", r.ID).Order("id").Find(&t.Splits).Error; err != nil {
+			return err
+		}
+		change.RowTable, change.RowID, before = "transactions", r.ID, t
+	case *RawTransaction:
+		change.RowTable, change.RowID, before = "raw_transactions", r.ID, r
+	default:
+		return fmt.Errorf("can't record an import's change to a %T", row)
+	}
+	data, err := json.Marshal(before)
+	if err != nil {
+		return err
+	}
+	change.Before = string(data)
+	return tx.Create(&change).Error
+}
+
+// restore puts the changed row back as it was, reporting whether it was
+// still there to restore
+func (c *ImportChange) restore(tx *gorm.DB) (bool, error) {
+	switch c.RowTable {
+	case "transactions":
+		var before changedTransaction
+		if err := json.Unmarshal([]byte(c.Before), &before); err != nil {
+			return false, err
+		}
+		result := tx.Model(&Transaction{ID: c.RowID}).Select("*").Omit("id", "created_at").Updates(&before.Transaction)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return false, result.Error
+		}
+		if err := tx.Where("transaction_id = ?", c.RowID).Delete(&TransactionSplit{}).Error; err != nil {
+			return false, err
+		}
+		for i := range before.Splits {
+			before.Splits[i].ID = 0
+		}
+		if len(before.Splits) > 0 {
+			if err := tx.Create(&before.Splits).Error; err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	case "raw_transactions":
+		var before RawTransaction
+		if err := json.Unmarshal([]byte(c.Before), &before); err != nil {
+			return false, err
+		}
+		result := tx.Model(&RawTransaction{ID: c.RowID}).Select("*").Omit("id", "created_at").Updates(&before)
+		return result.RowsAffected > 0, result.Error
+	}
+	return false, fmt.Errorf("unknown table %q", c.RowTable)
+}
+
+// UpdateFromRaw applies a staged update to the transaction it matched
+func (t *Transaction) UpdateFromRaw(raw *RawTransaction) {
+	t.Beneficiary = raw.Beneficiary
+	if raw.Budget != UNCATEGORIZED_BUDGET {
+		t.Budget = raw.Budget
+	}
+	t.RawHint = raw.RawHint
+	if raw.TransactionDate != "" {
+		t.TransactionDate = raw.TransactionDate
+	}
+	if t.ExternalID == "" {
+		t.ExternalID = raw.ExternalID
+	}
+	if t.CheckNumber == "" {
+		t.CheckNumber = raw.CheckNumber
+	}
+	if raw.Memo != "" {
+		t.Memo = raw.Memo
+	}
+	// Keep the transaction's provenance from its first import
+	if t.SourceRow == "" {
+		t.SourceFile, t.SourceLine, t.SourceRow = raw.SourceFile, raw.SourceLine, raw.SourceRow
+	}
+}
+
+// FinalizeImport moves the raw transactions that have a budget into
+// transactions, and suggests tags for those budgeted by hand.
+func (s *Service) FinalizeImport() (*FinalizeResult, error) {
 	var rawList []RawTransaction
 	if err := s.DB.Find(&rawList).Error; err != nil {
-		return "", err
+		return nil, err
 	}
 
 	added := 0   //new tx in tx table
 	updated := 0 // existing tx updated in tx table
 	skipped := 0 // raw tx left in raw table because uncategorized.
 
+	var finalized, remaining []RawTransaction // For suggesting tags
+
 	tx := s.DB.Begin()
 
 	for _, raw := range rawList {
+		splits, err := ParseProposedSplits(raw.ProposedSplits)
+		if err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("%s %s %q: %w", raw.Account, raw.PostedDate, raw.Description, err)
+		}
+		// Splits categorize a row, and the first one's budget is the transaction's if it has none
 		if raw.Budget == UNCATEGORIZED_BUDGET {
-			skipped++
-			continue
+			if len(splits) == 0 {
+				skipped++
+				remaining = append(remaining, raw)
+				continue
+			}
+			raw.Budget = splits[0].Budget
 		}
 
+		finalized = append(finalized, raw)
+
+		var t Transaction // The transaction the row became
 		switch raw.Action {
 		case "add":
 			// Create new Transaction
-			t := Transaction{
-				PostedDate:  raw.PostedDate,
-				Account:     raw.Account,
-				Amount:      raw.Amount,
-				Description: raw.Description,
-				Beneficiary: raw.Beneficiary,
-				Budget:      raw.Budget,
-				RawHint:     raw.RawHint,
+			t = Transaction{
+				PostedDate:      raw.PostedDate,
+				TransactionDate: raw.TransactionDate,
+				Account:         raw.Account,
+				Amount:          raw.Amount,
+				Currency:        raw.Currency,
+				Description:     raw.Description,
+				Beneficiary:     raw.Beneficiary,
+				Budget:          raw.Budget,
+				RawHint:         raw.RawHint,
+				ExternalID:      raw.ExternalID,
+				CheckNumber:     raw.CheckNumber,
+				Memo:            raw.Memo,
+				ImportBatchID:   raw.ImportBatchID,
+				SourceFile:      raw.SourceFile,
+				SourceLine:      raw.SourceLine,
+				SourceRow:       raw.SourceRow,
 			}
 			if err := tx.Create(&t).Error; err != nil {
 				tx.Rollback()
-				return "", err
+				return nil, err
 			}
 			added++
 		case "update":
 			var target Transaction
-			result := tx.Where("account_id = ? AND posted_date = ? AND amount = ? AND description = ?",
-				raw.Account, raw.PostedDate, raw.Amount, raw.Description).First(&target)
+			result := tx.First(&target, raw.TransactionID)
+			if result.Error != nil {
+				result = tx.Where("account = ? AND external_id = ? AND external_id != ''", raw.Account, raw.ExternalID).First(&target)
+			}
+			if result.Error != nil {
+				result = tx.Where("account = ? AND posted_date = ? AND amount = ? AND description = ?",
+					raw.Account, raw.PostedDate, raw.Amount, raw.Description).First(&target)
+			}
 
 			if result.Error == nil {
-				// Found match. Update it.
-				target.Beneficiary = raw.Beneficiary
-				target.Budget = raw.Budget
-				target.RawHint = raw.RawHint
+				// Found match. Update it, keeping what it was for rolling the import back
+				if raw.ImportBatchID != nil {
+					if err := RecordImportChange(tx, *raw.ImportBatchID, &target); err != nil {
+						tx.Rollback()
+						return nil, err
+					}
+				}
+				target.UpdateFromRaw(&raw)
 				if err := tx.Save(&target).Error; err != nil {
 					tx.Rollback()
-					return "", err
+					return nil, err
 				}
+				t = target
 				updated++
 			} else {
 				// Not found. Treat as new to avoid data loss.
-				t := Transaction{
-					PostedDate:  raw.PostedDate,
-					Account:     raw.Account,
-					Amount:      raw.Amount,
-					Description: raw.Description,
-					Beneficiary: raw.Beneficiary,
-					Budget:      raw.Budget,
-					RawHint:     raw.RawHint,
+				t = Transaction{
+					PostedDate:      raw.PostedDate,
+					TransactionDate: raw.TransactionDate,
+					Account:         raw.Account,
+					Amount:          raw.Amount,
+					Currency:        raw.Currency,
+					Description:     raw.Description,
+					Beneficiary:     raw.Beneficiary,
+					Budget:          raw.Budget,
+					RawHint:         raw.RawHint,
+					ExternalID:      raw.ExternalID,
+					CheckNumber:     raw.CheckNumber,
+					Memo:            raw.Memo,
+					ImportBatchID:   raw.ImportBatchID,
+					SourceFile:      raw.SourceFile,
+					SourceLine:      raw.SourceLine,
+					SourceRow:       raw.SourceRow,
 				}
 				if err := tx.Create(&t).Error; err != nil {
 					tx.Rollback()
-					return "", err
+					return nil, err
 				}
 				updated++
 			}
 		}
+
+		if len(splits) > 0 && t.ID != 0 {
+			if err := setSplits(tx, &t, splits); err != nil {
+				tx.Rollback()
+				return nil, fmt.Errorf("%s %s %q: %w", raw.Account, raw.PostedDate, raw.Description, err)
+			}
+		}
 	}
 
 	// Empty Raw
-	if err := tx.Exec("DELETE FROM raw_transactions WHERE budget != ?", UNCATEGORIZED_BUDGET).Error; err != nil {
+	if err := tx.Exec("DELETE FROM raw_transactions WHERE budget != ? OR proposed_splits != ''", UNCATEGORIZED_BUDGET).Error; err != nil {
 		tx.Rollback()
-		return "", err
+		return nil, err
+	}
+
+	suggestions, err := suggestTags(tx, finalized, remaining)
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("suggesting tags failed: %w", err)
 	}
 
 	tx.Commit()
-	return fmt.Sprintf("Finalized: %d added, %d updated, %d remain to be categorized.", added, updated, skipped), nil
-}
-
-func (s *Service) ApplyTags() (int64, error) {
-	// 1. Tagging Query
-	// Updates raw_transactions.tag based on description patterns
-	taggingQuery := `
-	WITH t1 AS (
-		SELECT
-			id,
-			CASE
-				WHEN description LIKE 'money transfer authorized on __/__ %' THEN substr(description, 36)
-				WHEN description LIKE 'purchase authorized on __/__ %' THEN substr(description, 30)
-				WHEN description LIKE 'purchase intl authorized on __/__ %' THEN substr(description, 35)
-				ELSE description
-			END AS stem1
-		FROM raw_transactions
-	),
-	t2 AS (
-		SELECT
-			id,
-			CASE
-				WHEN stem1 LIKE '___*%' THEN substr(stem1, 5)
-				WHEN stem1 LIKE 'cash app*%' THEN substr(stem1, 10)
-				WHEN stem1 LIKE 'zelle to %' THEN substr(stem1, 10)
-				WHEN stem1 LIKE 'paypal *%' THEN substr(stem1, 9)
-				ELSE stem1
-			END AS stem
-		FROM t1
-	)
+	result := &FinalizeResult{Added: added, Updated: updated, Remaining: skipped, Suggestions: suggestions}
+	result.Message = fmt.Sprintf("Finalized: %d added, %d updated, %d remain to be categorized.", added, updated, skipped)
+	if len(suggestions) > 0 {
+		result.Message += fmt.Sprintf(" %d new tags suggested.", len(suggestions))
+	}
+	return result, nil
+}
+
+// ApplyTags tags, then budgets, every raw transaction, see StemRule and Tag.
+// The result lists transactions that tags disagreed about.
+func (s *Service) ApplyTags() (*ApplyTagsResult, error) {
+	// 1. Tagging: each raw transaction's tag is its description stemmed by the stem rules
+
+	// Cleared checks that are in the check register
+	const checkMatch = `c.account = raw_transactions.account
+		AND raw_transactions.check_number != ''
+		AND ltrim(c.number, '0') = ltrim(raw_transactions.check_number, '0')`
+
+	// 2. Check Payee Query
+	// Tags cleared checks with the payee from the check register
+	checkPayeeQuery := `
 	UPDATE raw_transactions
-	SET tag = t2.stem
-	FROM t2
-	WHERE raw_transactions.id = t2.id;
+	SET tag = c.payee
+	FROM checks c
+	WHERE ` + checkMatch + ` AND c.payee != '';
 	`
 
-	// 2. Budget Mapping Query
-	// Updates raw_transactions.budget based on tag matches in tags table
-	budgetQuery := `
+	// 3. Budget Mapping: the first tag each raw transaction matches gives it a budget,
+	// except for checks whose budget is in the check register
+	registeredCheck := `EXISTS (SELECT 1 FROM checks c WHERE ` + checkMatch + ` AND c.budget != '')`
+
+	// 4. Check Budget Query
+	checkBudgetQuery := `
 	UPDATE raw_transactions
-	SET budget = t.budget
-	FROM tags t
-	WHERE substr(raw_transactions.tag, 1, length(t.name)) = t.name;
+	SET budget = c.budget
+	FROM checks c
+	WHERE ` + checkMatch + ` AND c.budget != '';
 	`
 
 	tx := s.DB.Begin()
 	if tx.Error != nil {
-		return 0, tx.Error
+		return nil, tx.Error
 	}
 
 	// Run Tagging
-	if err := tx.Exec(taggingQuery).Error; err != nil {
+	if err := applyStemRules(tx); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("tagging failed: %w", err)
+	}
+
+	// Run Check Payees
+	if err := tx.Exec(checkPayeeQuery).Error; err != nil {
 		tx.Rollback()
-		return 0, fmt.Errorf("tagging query failed: %w", err)
+		return nil, fmt.Errorf("check payee query failed: %w", err)
 	}
 
 	// Run Budget Mapping
-	result := tx.Exec(budgetQuery)
-	if result.Error != nil {
+	matched, conflicts, err := applyTagRules(tx, registeredCheck)
+	if err != nil {
 		tx.Rollback()
-		return 0, fmt.Errorf("budget mapping query failed: %w", result.Error)
+		return nil, fmt.Errorf("budget mapping failed: %w", err)
+	}
+
+	// Run Check Budgets
+	checkResult := tx.Exec(checkBudgetQuery)
+	if checkResult.Error != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("check budget query failed: %w", checkResult.Error)
 	}
 
 	if err := tx.Commit().Error; err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	return result.RowsAffected, nil
+	result := &ApplyTagsResult{Budgeted: matched + checkResult.RowsAffected, Conflicts: conflicts}
+	result.Message = fmt.Sprintf("Auto-applied budgets for %d transactions.", result.Budgeted)
+	if len(conflicts) > 0 {
+		result.Message += fmt.Sprintf(" %d matched tags with different budgets; the longest match was used.", len(conflicts))
+	}
+	return result, nil
 }
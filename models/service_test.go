@@ -0,0 +1,123 @@
+package models
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewService_SeedsFilePatterns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "budget.db")
+	s, err := NewService(path)
+	require.NoError(t, err)
+	require.NoError(t, s.Clean())
+
+	// A database from before file patterns gets the default accounts' patterns
+	require.NoError(t, s.DB.Migrator().DropColumn(&Account{}, "FilePattern"))
+	s, err = NewService(path)
+	require.NoError(t, err)
+	var account Account
+	require.NoError(t, s.DB.First(&account, "name = ?", "WfVisa").Error)
+	assert.Equal(t, "CreditCard*.csv", account.FilePattern)
+
+	// Which the user can then clear
+	cleared := account
+	cleared.FilePattern = ""
+	require.NoError(t, s.UpdateAccount(&account, &cleared))
+	s, err = NewService(path)
+	require.NoError(t, err)
+	require.NoError(t, s.DB.First(&account, "name = ?", "WfVisa").Error)
+	assert.Empty(t, account.FilePattern)
+}
+
+func TestNewService_SeedsCardBeneficiaries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "budget.db")
+	s, err := NewService(path)
+	require.NoError(t, err)
+	require.NoError(t, s.Clean())
+
+	// A database from before card holders were a table gets the ones that were built in
+	require.NoError(t, s.DB.Migrator().DropTable(&CardBeneficiary{}))
+	require.NoError(t, s.DB.Delete(&Beneficiary{Name: "Jessie"}).Error)
+	s, err = NewService(path)
+	require.NoError(t, err)
+	cards, err := s.GetCardBeneficiaries()
+	require.NoError(t, err)
+	require.Len(t, cards, 1, "Jessie's card is left out, Jessie isn't a beneficiary any more")
+	assert.Equal(t, "Bob", cards[0].Beneficiary)
+
+	// Cards the user deleted stay deleted
+	require.NoError(t, s.DB.Delete(&cards[0]).Error)
+	s, err = NewService(path)
+	require.NoError(t, err)
+	cards, err = s.GetCardBeneficiaries()
+	require.NoError(t, err)
+	assert.Empty(t, cards)
+}
+
+func TestUpdate_ClearsFields(t *testing.T) {
+	s := SetupTestService(t)
+	require.NoError(t, s.Clean())
+	require.NoError(t, s.AddBudget(&Budget{Name: "Groceries", Beneficiary: "Us"}))
+
+	tag := Tag{Name: "kroger", Budget: "Groceries", Beneficiary: "Bob", Account: "WfVisa", Sign: TagSignExpense,
+		MinAmount: 100, MinDay: 2, Priority: 3}
+	require.NoError(t, s.AddTag(&tag))
+	require.NoError(t, s.UpdateTag(&tag, &Tag{ID: tag.ID, Name: "kroger", Budget: "Groceries"}))
+	var gotTag Tag
+	require.NoError(t, s.DB.First(&gotTag, tag.ID).Error)
+	assert.Equal(t, Tag{ID: tag.ID, Name: "kroger", Budget: "Groceries"}, gotTag)
+
+	rule := StemRule{Stage: 3, Pattern: "ACH DEBIT ", Match: StemMatchPrefix, Action: StemStrip, Account: "WfChecking"}
+	require.NoError(t, s.AddStemRule(&rule))
+	cleared := rule
+	cleared.Account = ""
+	require.NoError(t, s.UpdateStemRule(&rule, &cleared))
+	var gotRule StemRule
+	require.NoError(t, s.DB.First(&gotRule, rule.ID).Error)
+	assert.Empty(t, gotRule.Account)
+
+	check := Check{Account: "WfChecking", Number: "101", Payee: "grandma", Budget: "Groceries"}
+	require.NoError(t, s.AddCheck(&check))
+	clearedCheck := check
+	clearedCheck.Budget = ""
+	require.NoError(t, s.UpdateCheck(&check, &clearedCheck))
+	var gotCheck Check
+	require.NoError(t, s.DB.First(&gotCheck, check.ID).Error)
+	assert.Empty(t, gotCheck.Budget)
+	assert.Equal(t, "grandma", gotCheck.Payee)
+}
+
+func TestUpdateImportFormat_ClearsFields(t *testing.T) {
+	s := SetupTestService(t)
+	require.NoError(t, s.Clean())
+
+	format := ImportFormat{Name: "CU", DateLayouts: "2006-01-02", PostedDateColumn: "0", AmountColumn: "1",
+		MinColumns: 3, NegateAmount: true, DefaultBeneficiary: "Us"}
+	require.NoError(t, s.AddImportFormat(&format))
+	cleared := format
+	cleared.AmountColumn, cleared.DebitColumn, cleared.CreditColumn = "", "1", "2"
+	cleared.MinColumns, cleared.NegateAmount, cleared.DefaultBeneficiary = 0, false, ""
+	require.NoError(t, s.UpdateImportFormat(&format, &cleared))
+
+	var got ImportFormat
+	require.NoError(t, s.DB.First(&got, "name = ?", "CU").Error)
+	assert.Equal(t, cleared, got)
+}
+
+func TestUpdateCardBeneficiary_ClearsFields(t *testing.T) {
+	s := SetupTestService(t)
+	require.NoError(t, s.Clean())
+
+	card := CardBeneficiary{Account: "CapitalOne", CardSuffix: "1234", Beneficiary: "Bob"}
+	require.NoError(t, s.AddCardBeneficiary(&card))
+	cleared := card
+	cleared.CardSuffix = ""
+	require.NoError(t, s.UpdateCardBeneficiary(&card, &cleared))
+
+	var got CardBeneficiary
+	require.NoError(t, s.DB.First(&got, card.ID).Error)
+	assert.Equal(t, cleared, got)
+}
@@ -0,0 +1,111 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// TransactionSplit is part of a transaction's amount spent on a budget of its own,
+// e.g. the groceries, household and gifts in one Costco charge.
+// A transaction with splits is reported by its splits, which add up to its
+// amount, and its own Budget is only the one shown in the transaction list.
+type TransactionSplit struct {
+	ID             uint         `gorm:"primarykey;autoIncrement"`
+	TransactionID  uint         `gorm:"index"`
+	TransactionObj *Transaction `gorm:"foreignKey:TransactionID;constraint:OnDelete:CASCADE" json:"-"`
+	Budget         string
+	BudgetObj      *Budget      `gorm:"foreignKey:Budget;references:Name" json:"-"`
+	Beneficiary    string       // The transaction's beneficiary if empty
+	BeneficiaryObj *Beneficiary `gorm:"foreignKey:Beneficiary;references:Name" json:"-"`
+	Amount         Money        // In the transaction's currency
+	Memo           string
+}
+
+// --- Transaction Splits ---
+
+func (s *Service) GetTransactionSplits(transactionID uint) ([]TransactionSplit, error) {
+	var splits []TransactionSplit
+	err := s.DB.Where("transaction_id = ?", transactionID).Order("id").Find(&splits).Error
+	return splits, err
+}
+
+// SetTransactionSplits replaces the splits of a transaction.  The splits must
+// add up to the transaction's amount; no splits at all puts the whole amount
+// back on the transaction's own budget.
+func (s *Service) SetTransactionSplits(transactionID uint, splits []TransactionSplit) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		var t Transaction
+		if err := tx.First(&t, transactionID).Error; err != nil {
+			return err
+		}
+		return setSplits(tx, &t, splits)
+	})
+}
+
+// setSplits replaces the splits of a transaction, within a DB transaction
+func setSplits(tx *gorm.DB, t *Transaction, splits []TransactionSplit) error {
+	if err := checkSplits(t, splits); err != nil {
+		return err
+	}
+	if err := tx.Where("transaction_id = ?", t.ID).Delete(&TransactionSplit{}).Error; err != nil {
+		return err
+	}
+	if len(splits) == 0 {
+		return nil
+	}
+	for i := range splits {
+		splits[i].ID = 0
+		splits[i].TransactionID = t.ID
+		if splits[i].Beneficiary == "" {
+			splits[i].Beneficiary = t.Beneficiary
+		}
+	}
+	return tx.Create(&splits).Error
+}
+
+// checkSplits makes sure splits are complete and add up to the transaction's amount
+func checkSplits(t *Transaction, splits []TransactionSplit) error {
+	if len(splits) == 0 {
+		return nil
+	}
+	var total Money
+	for i, split := range splits {
+		if strings.TrimSpace(split.Budget) == "" {
+			return fmt.Errorf("split %d has no budget", i+1)
+		}
+		total += split.Amount
+	}
+	if total != t.Amount {
+		return fmt.Errorf("splits add up to %s, not the transaction's %s",
+			strings.TrimSpace(CurrencyAmount{Amount: total, Currency: t.Currency}.String()),
+			strings.TrimSpace(CurrencyAmount{Amount: t.Amount, Currency: t.Currency}.String()))
+	}
+	return nil
+}
+
+// hasSplits reports whether a transaction has been split
+func hasSplits(tx *gorm.DB, transactionID uint) (bool, error) {
+	var count int64
+	err := tx.Model(&TransactionSplit{}).Where("transaction_id = ?", transactionID).Count(&count).Error
+	return count > 0, err
+}
+
+// ParseProposedSplits reads the splits proposed for a staged transaction,
+// a JSON array like [{"Budget":"Groceries","Amount":4000},{"Budget":"Household","Amount":2000}].
+func ParseProposedSplits(proposed string) ([]TransactionSplit, error) {
+	if strings.TrimSpace(proposed) == "" {
+		return nil, nil
+	}
+	var splits []TransactionSplit
+	if err := json.Unmarshal([]byte(proposed), &splits); err != nil {
+		return nil, fmt.Errorf("invalid proposed splits: %w", err)
+	}
+	if len(splits) == 0 {
+		return nil, errors.New("invalid proposed splits: none given")
+	}
+	return splits, nil
+}
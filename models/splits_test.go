@@ -0,0 +1,108 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetTransactionSplits(t *testing.T) {
+	s := SetupTestService(t)
+	require.NoError(t, s.Clean())
+	for _, name := range []string{"Groceries", "Household", "Gifts"} {
+		require.NoError(t, s.AddBudget(&Budget{Name: name, Beneficiary: "Us"}))
+	}
+
+	costco := Transaction{PostedDate: "2026-01-10", Account: "CapitalOne", Amount: 10000, Description: "COSTCO",
+		Beneficiary: "Us", Budget: "Groceries"}
+	require.NoError(t, s.AddTransaction(&costco))
+	other := Transaction{PostedDate: "2026-01-12", Account: "CapitalOne", Amount: 2000, Description: "KROGER",
+		Beneficiary: "Us", Budget: "Groceries"}
+	require.NoError(t, s.AddTransaction(&other))
+
+	// Splits must add up, and each needs a budget
+	err := s.SetTransactionSplits(costco.ID, []TransactionSplit{{Budget: "Groceries", Amount: 6000}, {Budget: "Household", Amount: 3000}})
+	assert.ErrorContains(t, err, "splits add up to 90.00, not the transaction's 100.00")
+	err = s.SetTransactionSplits(costco.ID, []TransactionSplit{{Budget: "Groceries", Amount: 6000}, {Amount: 4000}})
+	assert.ErrorContains(t, err, "split 2 has no budget")
+
+	require.NoError(t, s.SetTransactionSplits(costco.ID, []TransactionSplit{
+		{Budget: "Groceries", Amount: 6000},
+		{Budget: "Household", Amount: 3000, Memo: "Paper towels"},
+		{Budget: "Gifts", Beneficiary: "Jessie", Amount: 1000},
+	}))
+	splits, err := s.GetTransactionSplits(costco.ID)
+	require.NoError(t, err)
+	require.Len(t, splits, 3)
+	assert.Equal(t, "Us", splits[0].Beneficiary) // The transaction's
+	assert.Equal(t, "Jessie", splits[2].Beneficiary)
+
+	// Reports count the splits instead of the transaction
+	spending, err := s.GetMonthlySpending(PostedDateBasis)
+	require.NoError(t, err)
+	assert.Equal(t, []MonthlySpending{
+		{Month: "2026-01", Budget: "Gifts", Beneficiary: "Jessie", Count: 1, Amount: 1000},
+		{Month: "2026-01", Budget: "Groceries", Beneficiary: "Us", Count: 2, Amount: 6000 + 2000},
+		{Month: "2026-01", Budget: "Household", Beneficiary: "Us", Count: 1, Amount: 3000},
+	}, spending)
+
+	// The amount can't change under the splits
+	err = s.UpdateTransaction(&costco, &Transaction{Amount: 12000})
+	assert.ErrorContains(t, err, "the transaction is split")
+	require.NoError(t, s.UpdateTransaction(&costco, &Transaction{Memo: "Membership renewed"}))
+
+	// Replacing splits with none puts the whole amount back on the transaction
+	require.NoError(t, s.SetTransactionSplits(costco.ID, nil))
+	splits, err = s.GetTransactionSplits(costco.ID)
+	require.NoError(t, err)
+	assert.Empty(t, splits)
+	require.NoError(t, s.UpdateTransaction(&costco, &Transaction{Amount: 12000}))
+
+	// Deleting a transaction deletes its splits
+	require.NoError(t, s.SetTransactionSplits(other.ID, []TransactionSplit{{Budget: "Groceries", Amount: 1500}, {Budget: "Gifts", Amount: 500}}))
+	require.NoError(t, s.DeleteTransaction(&other))
+	var count int64
+	require.NoError(t, s.DB.Model(&TransactionSplit{}).Count(&count).Error)
+	assert.Zero(t, count)
+}
+
+func TestFinalizeImport_ProposedSplits(t *testing.T) {
+	s := SetupTestService(t)
+	require.NoError(t, s.Clean())
+	for _, name := range []string{"Groceries", "Household"} {
+		require.NoError(t, s.AddBudget(&Budget{Name: name, Beneficiary: "Us"}))
+	}
+
+	require.NoError(t, s.AddRawTransaction(&RawTransaction{PostedDate: "2026-01-10", Account: "CapitalOne", Amount: 10000,
+		Description: "COSTCO", Beneficiary: "Us", Action: "add",
+		ProposedSplits: `[{"Budget":"Groceries","Amount":7000},{"Budget":"Household","Amount":3000,"Memo":"Bin bags"}]`}))
+	require.NoError(t, s.AddRawTransaction(&RawTransaction{PostedDate: "2026-01-11", Account: "CapitalOne", Amount: 500,
+		Description: "UNCATEGORIZED", Beneficiary: "Us", Action: "add"}))
+
+	result, err := s.FinalizeImport()
+	require.NoError(t, err)
+	assert.Equal(t, "Finalized: 1 added, 0 updated, 1 remain to be categorized.", result.Message)
+
+	var costco Transaction
+	require.NoError(t, s.DB.Where("description = ?", "COSTCO").First(&costco).Error)
+	assert.Equal(t, "Groceries", costco.Budget) // The first split's, since the row had none
+	splits, err := s.GetTransactionSplits(costco.ID)
+	require.NoError(t, err)
+	require.Len(t, splits, 2)
+	assert.Equal(t, TransactionSplit{ID: splits[1].ID, TransactionID: costco.ID, Budget: "Household", Beneficiary: "Us",
+		Amount: 3000, Memo: "Bin bags"}, splits[1])
+
+	raws, err := s.GetRawTransactions()
+	require.NoError(t, err)
+	require.Len(t, raws, 1)
+	assert.Equal(t, "UNCATEGORIZED", raws[0].Description)
+
+	// Splits that don't add up leave everything staged
+	require.NoError(t, s.UpdateRawTransaction(&raws[0], &RawTransaction{ProposedSplits: `[{"Budget":"Groceries","Amount":400}]`}))
+	_, err = s.FinalizeImport()
+	assert.ErrorContains(t, err, `CapitalOne 2026-01-11 "UNCATEGORIZED": splits add up to 4.00, not the transaction's 5.00`)
+	raws, err = s.GetRawTransactions()
+	require.NoError(t, err)
+	assert.Len(t, raws, 1)
+}
@@ -0,0 +1,252 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// StemMatch is how a StemRule's Pattern is matched against a description
+type StemMatch string
+
+const (
+	StemMatchLike   StemMatch = "like"   // SQL LIKE: % is any run of characters, _ is any one character, case is ignored
+	StemMatchPrefix StemMatch = "prefix" // The description starts with the pattern, case is ignored
+	StemMatchRegex  StemMatch = "regex"  // Go regular expression
+)
+
+// StemAction is what a StemRule does to a description it matches
+type StemAction string
+
+const (
+	// StemStrip removes the matched text.  For a LIKE pattern that's the part
+	// before its final %, so "zelle to %" leaves whoever the transfer was to.
+	StemStrip StemAction = "strip"
+	// StemExtract keeps only the first group of a regex, e.g. `^CHECKCARD \d{4} (.+?) \d+$`
+	StemExtract StemAction = "extract"
+)
+
+// StemRule is one step in working out a transaction's tag from its description.
+// Banks wrap the merchant's name in boilerplate ("PURCHASE AUTHORIZED ON 12/31 ...",
+// "SQ *...") which rules strip off, so what's left can be matched against tags.
+//
+// Rules are applied a stage at a time, in order of Stage then Position.
+// Within a stage only the first rule that matches is applied; the next stage
+// starts from what it left.
+type StemRule struct {
+	ID          uint `gorm:"primarykey;autoIncrement"`
+	Stage       int
+	Position    int // Order within the stage
+	Pattern     string
+	Match       StemMatch
+	Action      StemAction
+	Account     string // Only descriptions from this account, all accounts if empty. *not* a foreign key
+	Description string // Why the rule is needed
+
+	re *regexp.Regexp // Compiled Pattern, see compile
+}
+
+// compile checks the rule and prepares its pattern for matching
+func (r *StemRule) compile() error {
+	if r.Pattern == "" {
+		return errors.New("stem rule needs a pattern")
+	}
+	var expr string
+	switch r.Match {
+	case StemMatchLike:
+		expr = likeToRegexp(r.Pattern)
+	case StemMatchPrefix:
+		expr = "(?is)^(" + regexp.QuoteMeta(r.Pattern) + ")"
+	case StemMatchRegex:
+		expr = r.Pattern
+	default:
+		return fmt.Errorf("unknown match %q, expected like, prefix or regex", r.Match)
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return fmt.Errorf("invalid pattern %q: %w", r.Pattern, err)
+	}
+
+	switch r.Action {
+	case StemStrip:
+	case StemExtract:
+		if r.Match != StemMatchRegex || re.NumSubexp() == 0 {
+			return errors.New("extract needs a regex with a group to keep")
+		}
+	default:
+		return fmt.Errorf("unknown action %q, expected strip or extract", r.Action)
+	}
+	r.re = re
+	return nil
+}
+
+// likeToRegexp translates a LIKE pattern, with the part before a final % as
+// the first group so that it can be stripped
+func likeToRegexp(pattern string) string {
+	head, tail := pattern, ""
+	if strings.HasSuffix(pattern, "%") {
+		head, tail = strings.TrimSuffix(pattern, "%"), ".*"
+	}
+	var b strings.Builder
+	b.WriteString("(?is)^(")
+	for _, c := range head {
+		switch c {
+		case '%':
+			b.WriteString(".*?")
+		case '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString(")" + tail + "$")
+	return b.String()
+}
+
+// apply returns the description with the rule applied, and whether the rule matched
+func (r *StemRule) apply(account, description string) (string, bool) {
+	if r.Account != "" && !strings.EqualFold(r.Account, account) {
+		return description, false
+	}
+	m := r.re.FindStringSubmatchIndex(description)
+	if m == nil {
+		return description, false
+	}
+	switch {
+	case r.Action == StemExtract:
+		return description[m[2]:m[3]], true
+	case r.Match == StemMatchRegex:
+		return description[:m[0]] + description[m[1]:], true
+	default:
+		// LIKE and prefix patterns put what to strip in their first group
+		return description[:m[2]] + description[m[3]:], true
+	}
+}
+
+// Stemmer applies a set of stem rules
+type Stemmer struct {
+	stages [][]StemRule
+}
+
+// NewStemmer compiles rules, which must already be in order
+func NewStemmer(rules []StemRule) (*Stemmer, error) {
+	st := &Stemmer{}
+	for i, r := range rules {
+		if err := r.compile(); err != nil {
+			return nil, fmt.Errorf("stem rule %d: %w", r.ID, err)
+		}
+		if i == 0 || r.Stage != rules[i-1].Stage {
+			st.stages = append(st.stages, nil)
+		}
+		st.stages[len(st.stages)-1] = append(st.stages[len(st.stages)-1], r)
+	}
+	return st, nil
+}
+
+// Stem returns what's left of a description once the rules are applied
+func (st *Stemmer) Stem(account, description string) string {
+	for _, stage := range st.stages {
+		for i := range stage {
+			if stem, ok := stage[i].apply(account, description); ok {
+				description = stem
+				break
+			}
+		}
+	}
+	return description
+}
+
+// defaultStemRules strip the boilerplate Wells Fargo and payment apps put round a merchant's name
+var defaultStemRules = []StemRule{
+	{Stage: 1, Position: 1, Pattern: "money transfer authorized on __/__ %", Match: StemMatchLike, Action: StemStrip},
+	{Stage: 1, Position: 2, Pattern: "purchase authorized on __/__ %", Match: StemMatchLike, Action: StemStrip},
+	{Stage: 1, Position: 3, Pattern: "purchase intl authorized on __/__ %", Match: StemMatchLike, Action: StemStrip},
+	{Stage: 2, Position: 1, Pattern: "___*%", Match: StemMatchLike, Action: StemStrip, Description: "Card processors, e.g. SQ *, TST*"},
+	{Stage: 2, Position: 2, Pattern: "cash app*%", Match: StemMatchLike, Action: StemStrip},
+	{Stage: 2, Position: 3, Pattern: "zelle to %", Match: StemMatchLike, Action: StemStrip},
+	{Stage: 2, Position: 4, Pattern: "paypal *%", Match: StemMatchLike, Action: StemStrip},
+}
+
+// loadStemmer compiles the stem rules
+func loadStemmer(tx *gorm.DB) (*Stemmer, error) {
+	var rules []StemRule
+	if err := tx.Order("stage, position, id").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	return NewStemmer(rules)
+}
+
+// tagOf is a raw transaction's stemmed, normalized description
+func (st *Stemmer) tagOf(raw *RawTransaction) string {
+	tag := st.Stem(raw.Account, raw.Description)
+	if raw.CheckNumber != "" {
+		return foldText(tag) // The number is all that tells one check from another
+	}
+	return NormalizeText(tag)
+}
+
+// applyStemRules sets the tag of every raw transaction to its stemmed, normalized description
+func applyStemRules(tx *gorm.DB) error {
+	stemmer, err := loadStemmer(tx)
+	if err != nil {
+		return err
+	}
+
+	var raws []RawTransaction
+	if err := tx.Select("id", "account", "description", "tag", "check_number").Find(&raws).Error; err != nil {
+		return err
+	}
+	for _, raw := range raws {
+		tag := stemmer.tagOf(&raw)
+		if tag == raw.Tag {
+			continue
+		}
+		if err := tx.Model(&RawTransaction{}).Where("id = ?", raw.ID).Update("tag", tag).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// --- Stem Rules ---
+
+func (s *Service) GetStemRules() ([]StemRule, error) {
+	var rules []StemRule
+	err := s.DB.Order("stage, position, id").Find(&rules).Error
+	return rules, err
+}
+
+func (s *Service) GetStemRulesPaginated(start, count int, sortKeys []SortOption) ([]StemRule, error) {
+	orderStr := BuildOrderString(sortKeys)
+	if orderStr == "" {
+		orderStr = "stage, position, id"
+	}
+	rules, _, err := GetPage[StemRule](s.DB, start, count, orderStr, nil)
+	return rules, err
+}
+
+func (s *Service) AddStemRule(rule *StemRule) error {
+	if err := rule.compile(); err != nil {
+		return err
+	}
+	return Create(s.DB, rule)
+}
+
+func (s *Service) UpdateStemRule(oldRule, newRule *StemRule) error {
+	if err := newRule.compile(); err != nil {
+		return err
+	}
+	return UpdateAll(s.DB, oldRule, newRule)
+}
+
+func (s *Service) DeleteStemRule(rule *StemRule) error {
+	return Delete(s.DB, rule)
+}
+
+// seedStemRules adds the default stem rules
+func (s *Service) seedStemRules() error {
+	return seedTable(s, defaultStemRules)
+}
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStemmer_DefaultRules(t *testing.T) {
+	st, err := NewStemmer(defaultStemRules)
+	require.NoError(t, err)
+
+	// As the SQL CASE they replace stemmed them
+	tests := []struct{ description, expected string }{
+		{"PURCHASE AUTHORIZED ON 12/30 KROGER #123", "KROGER #123"},
+		{"purchase intl authorized on 01/02 CAFE DE FLORE", "CAFE DE FLORE"},
+		{"MONEY TRANSFER AUTHORIZED ON 11/05 ZELLE TO BOB SMITH", "BOB SMITH"},
+		{"PURCHASE AUTHORIZED ON 12/30 SQ *BLUE BOTTLE", "BLUE BOTTLE"}, // Both stages
+		{"TST* THE DINER", " THE DINER"},
+		{"Cash App*Jessie", "Jessie"},
+		{"PAYPAL *EBAY", "EBAY"},
+		{"PURCHASE AUTHORIZED ON 1/30 KROGER", "PURCHASE AUTHORIZED ON 1/30 KROGER"}, // __/__ is exactly 5 characters
+		{"AMAZON.COM", "AMAZON.COM"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, st.Stem("WfChecking", tt.description), tt.description)
+	}
+}
+
+func TestStemmer_Rules(t *testing.T) {
+	st, err := NewStemmer([]StemRule{
+		{ID: 1, Stage: 1, Pattern: "POS ", Match: StemMatchPrefix, Action: StemStrip},
+		{ID: 2, Stage: 1, Pattern: "POS DEBIT ", Match: StemMatchPrefix, Action: StemStrip}, // Never reached, the first match wins
+		{ID: 3, Stage: 2, Pattern: ` #\d+$`, Match: StemMatchRegex, Action: StemStrip},
+		{ID: 4, Stage: 3, Pattern: `^CHECKCARD \d{4} (.+?) \d{6,}$`, Match: StemMatchRegex, Action: StemExtract, Account: "WfVisa"},
+		{ID: 5, Stage: 3, Pattern: "%*%", Match: StemMatchLike, Action: StemStrip},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "DEBIT KROGER", st.Stem("WfChecking", "pos DEBIT KROGER #123"))
+	assert.Equal(t, "SHELL OIL", st.Stem("WfVisa", "CHECKCARD 1231 SHELL OIL 12345678"))
+	assert.Equal(t, "CHECKCARD 1231 SHELL OIL 12345678", st.Stem("WfChecking", "CHECKCARD 1231 SHELL OIL 12345678")) // Other account
+	assert.Equal(t, "EBAY*SELLER", st.Stem("WfChecking", "PAYPAL*EBAY*SELLER"))                                      // Shortest before the final %
+
+	for _, bad := range []StemRule{
+		{Pattern: "", Match: StemMatchPrefix, Action: StemStrip},
+		{Pattern: "x", Match: "glob", Action: StemStrip},
+		{Pattern: "(", Match: StemMatchRegex, Action: StemStrip},
+		{Pattern: "x", Match: StemMatchRegex, Action: "replace"},
+		{Pattern: "x%", Match: StemMatchLike, Action: StemExtract},
+		{Pattern: "^x", Match: StemMatchRegex, Action: StemExtract},
+	} {
+		_, err := NewStemmer([]StemRule{bad})
+		assert.Error(t, err, "%+v", bad)
+	}
+}
+
+func TestStemRules_Service(t *testing.T) {
+	s := SetupTestService(t)
+	require.NoError(t, s.Clean())
+
+	rules, err := s.GetStemRules()
+	require.NoError(t, err)
+	assert.Len(t, rules, len(defaultStemRules))
+
+	assert.ErrorContains(t, s.AddStemRule(&StemRule{Stage: 3, Pattern: "(", Match: StemMatchRegex, Action: StemStrip}), "invalid pattern")
+	require.NoError(t, s.AddStemRule(&StemRule{Stage: 3, Pattern: "ACH DEBIT ", Match: StemMatchPrefix, Action: StemStrip, Account: "WfChecking"}))
+	require.NoError(t, s.AddRawTransaction(&RawTransaction{PostedDate: "2026-01-02", Account: "WfChecking", Amount: 100,
+		Description: "PURCHASE AUTHORIZED ON 01/01 ACH DEBIT CITY WATER"}))
+
+	_, err = s.ApplyTags()
+	require.NoError(t, err)
+	raws, err := s.GetRawTransactions()
+	require.NoError(t, err)
+	require.Len(t, raws, 1)
+	assert.Equal(t, "city water", raws[0].Tag)
+}
+
+func TestNewService_SeedsStemRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "budget.db")
+	s, err := NewService(path)
+	require.NoError(t, err)
+	rules, err := s.GetStemRules()
+	require.NoError(t, err)
+	require.Len(t, rules, len(defaultStemRules))
+
+	// Rules the user deleted stay deleted
+	require.NoError(t, s.DeleteStemRule(&rules[0]))
+	s, err = NewService(path)
+	require.NoError(t, err)
+	rules, err = s.GetStemRules()
+	require.NoError(t, err)
+	assert.Len(t, rules, len(defaultStemRules)-1)
+
+	// A database from before stem rules gets the rules it used to have built in
+	require.NoError(t, s.DB.Migrator().DropTable(&StemRule{}))
+	s, err = NewService(path)
+	require.NoError(t, err)
+	rules, err = s.GetStemRules()
+	require.NoError(t, err)
+	assert.Len(t, rules, len(defaultStemRules))
+}
@@ -0,0 +1,144 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+// TagSuggestion is a tag learned from transactions the user budgeted by hand,
+// for them to accept with AcceptTagSuggestions
+type TagSuggestion struct {
+	Name    string // The transactions' tag
+	Budget  string // The budget most of them were given
+	Count   int    // Finalized transactions it was learned from
+	Affects int    // Transactions still staged that it would budget
+}
+
+// FinalizeResult says what FinalizeImport did
+type FinalizeResult struct {
+	Message     string
+	Added       int // New transactions
+	Updated     int // Existing transactions updated
+	Remaining   int // Raw transactions left staged because they have no budget
+	Suggestions []TagSuggestion
+}
+
+// plainTags finds the tags named name that match the tag by prefix without
+// further conditions, the kind suggestions are
+func plainTags(tx *gorm.DB, name string) *gorm.DB {
+	return tx.Model(&Tag{}).Where("name = ? AND field IN ? AND match IN ?", name, []TagField{"", TagFieldTag}, []TagMatch{"", TagMatchPrefix}).
+		Where("account = '' AND sign = '' AND min_amount = 0 AND max_amount = 0 AND min_day = 0 AND max_day = 0")
+}
+
+// suggestTags proposes a tag for each tag finalized rows were budgeted with by
+// hand, i.e. that no tag gave them their budget.  Checks are left to the
+// check register, split rows to their splits, and "--unbudgeted--" isn't
+// worth learning.  remaining are the rows left staged.
+func suggestTags(tx *gorm.DB, finalized, remaining []RawTransaction) ([]TagSuggestion, error) {
+	matchers, err := loadTagMatchers(tx)
+	if err != nil {
+		return nil, err
+	}
+	stemmer, err := loadStemmer(tx)
+	if err != nil {
+		return nil, err
+	}
+	tagOf := func(raw *RawTransaction) string {
+		if raw.Tag != "" {
+			return raw.Tag
+		}
+		return stemmer.tagOf(raw)
+	}
+
+	// Budgets each tag was given by hand, counted
+	budgets := map[string]map[string]int{}
+	var names []string // In the order first seen
+	for i := range finalized {
+		raw := &finalized[i]
+		if raw.Budget == PLACEHOLDER_BUDGET || raw.CheckNumber != "" || raw.ProposedSplits != "" {
+			continue
+		}
+		name := tagOf(raw)
+		if name == "" {
+			continue
+		}
+		candidates, best := chooseTag(matchers, raw)
+		if best >= 0 && candidates[best].Length > 0 && candidates[best].Budget == raw.Budget {
+			continue // A tag did it
+		}
+		if budgets[name] == nil {
+			budgets[name] = map[string]int{}
+			names = append(names, name)
+		}
+		budgets[name][raw.Budget]++
+	}
+
+	var suggestions []TagSuggestion
+	for _, name := range names {
+		var exists int64
+		if err := plainTags(tx, name).Count(&exists).Error; err != nil {
+			return nil, err
+		}
+		if exists > 0 {
+			continue // The user budgeted these differently from the tag, which is theirs to change
+		}
+
+		suggestion := TagSuggestion{Name: name}
+		for budget, count := range budgets[name] {
+			if count > suggestion.Count || count == suggestion.Count && budget < suggestion.Budget {
+				suggestion.Budget, suggestion.Count = budget, count
+			}
+		}
+		m, err := (&Tag{Name: name, Budget: suggestion.Budget}).compile()
+		if err != nil {
+			return nil, err
+		}
+		for i := range remaining {
+			raw := remaining[i]
+			raw.Tag = tagOf(&raw)
+			if _, ok := m.matches(&raw); ok {
+				suggestion.Affects++
+			}
+		}
+		suggestions = append(suggestions, suggestion)
+	}
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		return suggestions[i].Count+suggestions[i].Affects > suggestions[j].Count+suggestions[j].Affects
+	})
+	return suggestions, nil
+}
+
+// --- Tag Suggestions ---
+
+// AcceptTagSuggestions adds a tag for each suggestion, skipping any already
+// a tag.  It returns the number of tags added.
+func (s *Service) AcceptTagSuggestions(suggestions []TagSuggestion) (int, error) {
+	added := 0
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		for _, suggestion := range suggestions {
+			tag := Tag{Name: suggestion.Name, Budget: suggestion.Budget}
+			tag.normalize()
+			if _, err := tag.compile(); err != nil {
+				return err
+			}
+			var exists int64
+			if err := plainTags(tx, tag.Name).Count(&exists).Error; err != nil {
+				return err
+			}
+			if exists > 0 {
+				continue
+			}
+			if err := Create(tx, &tag); err != nil {
+				return fmt.Errorf("tag %q: %w", tag.Name, err)
+			}
+			added++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return added, nil
+}
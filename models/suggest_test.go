@@ -0,0 +1,70 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFinalizeImport_SuggestsTags(t *testing.T) {
+	s := SetupTestService(t)
+	require.NoError(t, s.Clean())
+	for _, name := range []string{"Groceries", "Dining"} {
+		require.NoError(t, s.AddBudget(&Budget{Name: name, Beneficiary: "Us"}))
+	}
+	require.NoError(t, s.AddTag(&Tag{Name: "kroger", Budget: "Groceries"}))
+
+	var byHand []string // Budgets the user gives after auto-tagging
+	for _, raw := range []RawTransaction{
+		{Description: "PURCHASE AUTHORIZED ON 01/02 KROGER #12"}, // Budgeted by its tag
+		{Description: "TST* BLUE BOTTLE 4455", Budget: "Dining"},
+		{Description: "TST* BLUE BOTTLE 9911", Budget: "Dining"},
+		{Description: "SQ *BLUE BOTTLE OAKLAND CA"}, // Left staged
+		{Description: "CORNER CAFE", Budget: "Dining"},
+		{Description: "CORNER CAFE", Budget: "Dining"},
+		{Description: "CORNER CAFE", Budget: "Groceries"},
+		{Description: "CHECK # 101", CheckNumber: "101", Budget: "Groceries"}, // For the check register
+		{Description: "MYSTERY"},                                              // Left "--unbudgeted--"
+	} {
+		byHand = append(byHand, raw.Budget)
+		raw.PostedDate, raw.Account, raw.Amount, raw.Beneficiary, raw.Action = "2026-04-01", "WfChecking", 1000, "Us", "add"
+		raw.Budget = ""
+		require.NoError(t, s.AddRawTransaction(&raw))
+	}
+	_, err := s.ApplyTags()
+	require.NoError(t, err)
+
+	// The user budgets what the tags didn't
+	raws, err := s.GetRawTransactions()
+	require.NoError(t, err)
+	for i, budget := range byHand {
+		if budget != "" {
+			require.NoError(t, s.DB.Model(&raws[i]).Update("budget", budget).Error)
+		}
+	}
+	require.NoError(t, s.DB.Model(&raws[3]).Update("budget", UNCATEGORIZED_BUDGET).Error)
+
+	result, err := s.FinalizeImport()
+	require.NoError(t, err)
+	assert.Equal(t, "Finalized: 8 added, 0 updated, 1 remain to be categorized. 2 new tags suggested.", result.Message)
+	assert.Equal(t, []TagSuggestion{
+		{Name: "blue bottle", Budget: "Dining", Count: 2, Affects: 1},
+		{Name: "corner cafe", Budget: "Dining", Count: 2}, // What most were given
+	}, result.Suggestions)
+
+	added, err := s.AcceptTagSuggestions(result.Suggestions)
+	require.NoError(t, err)
+	assert.Equal(t, 2, added)
+	added, err = s.AcceptTagSuggestions(result.Suggestions[:1])
+	require.NoError(t, err)
+	assert.Zero(t, added)
+
+	// Next time, the tag does it
+	_, err = s.ApplyTags()
+	require.NoError(t, err)
+	raws, err = s.GetRawTransactions()
+	require.NoError(t, err)
+	require.Len(t, raws, 1)
+	assert.Equal(t, "Dining", raws[0].Budget)
+}
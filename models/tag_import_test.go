@@ -3,6 +3,9 @@ package models
 import (
 	"testing"
 	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func SetupTestService(t *testing.T) *Service {
@@ -74,7 +77,7 @@ func TestApplyTags(t *testing.T) {
 	}
 
 	// 2. Run ApplyTags
-	count, err := s.ApplyTags()
+	result, err := s.ApplyTags()
 	if err != nil {
 		t.Fatalf("ApplyTags failed: %v", err)
 	}
@@ -84,8 +87,8 @@ func TestApplyTags(t *testing.T) {
 	// Check count: should be 1 (whole foods -> Food)
 	// Actually, update count depends on how many rows were updated by the second query (Budget Mapping).
 	// The "whole foods" one should match.
-	if count != 1 {
-		t.Errorf("Expected 1 updated row, got %d", count)
+	if result.Budgeted != 1 {
+		t.Errorf("Expected 1 updated row, got %d", result.Budgeted)
 	}
 
 	updatedTxs, err := s.GetRawTransactions()
@@ -97,8 +100,8 @@ func TestApplyTags(t *testing.T) {
 		t.Logf("Tx: %s, Tag: '%s', Budget: '%s'", tx.Description, tx.Tag, tx.Budget)
 
 		if tx.Description == "purchase authorized on 01/12 whole foods store #123" {
-			if tx.Tag != "whole foods store #123" {
-				t.Errorf("Expected tag 'whole foods store #123', got '%s'", tx.Tag)
+			if tx.Tag != "whole foods" {
+				t.Errorf("Expected tag 'whole foods', got '%s'", tx.Tag)
 			}
 			if tx.Budget != "Food" {
 				t.Errorf("Expected budget 'Food', got '%s'", tx.Budget)
@@ -117,3 +120,43 @@ func TestApplyTags(t *testing.T) {
 		}
 	}
 }
+
+func TestApplyTags_CheckRegister(t *testing.T) {
+	s := SetupTestService(t)
+
+	require.NoError(t, s.AddBeneficiary(&Beneficiary{Name: "Us"}))
+	require.NoError(t, s.AddAccount(&Account{Name: "Checking", Beneficiary: "Us"}))
+	require.NoError(t, s.AddBudget(&Budget{Name: "Gifts", Beneficiary: "Us"}))
+	require.NoError(t, s.AddTag(&Tag{Name: "grandma", Budget: "Gifts"}))
+
+	// The payee's tag gives the first check its budget, the second names its own
+	require.NoError(t, s.AddCheck(&Check{Account: "Checking", Number: "1001", Payee: "grandma", Amount: 5000}))
+	require.NoError(t, s.AddCheck(&Check{Account: "Checking", Number: "0567", Payee: "plumber", Budget: "House"}))
+
+	for _, raw := range []RawTransaction{
+		{PostedDate: "2026-01-05", Account: "Checking", Amount: 5000, Description: "CHECK # 1001", CheckNumber: "1001"},
+		{PostedDate: "2026-01-06", Account: "Checking", Amount: 25000, Description: "CHECK # 567", CheckNumber: "567"},
+		{PostedDate: "2026-01-07", Account: "Checking", Amount: 100, Description: "CHECK # 999", CheckNumber: "999"},
+		{PostedDate: "2026-01-07", Account: "Savings", Amount: 100, Description: "CHECK # 1001", CheckNumber: "1001"},
+	} {
+		require.NoError(t, s.AddRawTransaction(&raw))
+	}
+
+	result, err := s.ApplyTags()
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), result.Budgeted)
+
+	raws, err := s.GetRawTransactions()
+	require.NoError(t, err)
+	require.Len(t, raws, 4)
+	got := make([][2]string, len(raws))
+	for i, r := range raws {
+		got[i] = [2]string{r.Tag, r.Budget}
+	}
+	assert.Equal(t, [][2]string{
+		{"grandma", "Gifts"},
+		{"plumber", "House"},
+		{"check # 999", ""},  // Not in the register
+		{"check # 1001", ""}, // Another account's check
+	}, got)
+}
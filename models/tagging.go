@@ -0,0 +1,287 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// TagField is the text of a transaction a Tag's Name is matched against
+type TagField string
+
+const (
+	TagFieldTag         TagField = "tag" // The stemmed description, see StemRule
+	TagFieldDescription TagField = "description"
+	TagFieldRawHint     TagField = "rawhint" // The bank's own category, e.g. CapitalOne's
+)
+
+// TagMatch is how a Tag's Name is matched
+type TagMatch string
+
+const (
+	TagMatchPrefix   TagMatch = "prefix"   // The text starts with the name
+	TagMatchContains TagMatch = "contains" // The name is anywhere in the text
+	TagMatchRegex    TagMatch = "regex"    // Go regular expression
+)
+
+// TagSign limits a Tag to money going out or coming in
+type TagSign string
+
+const (
+	TagSignExpense TagSign = "expense" // Positive amounts
+	TagSignCredit  TagSign = "credit"  // Negative amounts, e.g. refunds and income
+)
+
+// tagMatcher is a Tag ready to be matched against raw transactions
+type tagMatcher struct {
+	tag  *Tag
+	name string         // Name with case and whitespace folded, see foldText
+	re   *regexp.Regexp // Set for TagMatchRegex
+}
+
+// normalize puts a tag that matches stemmed tags by prefix or contents in the
+// form ApplyTags leaves them in, see NormalizeText
+func (t *Tag) normalize() {
+	if (t.Field == "" || t.Field == TagFieldTag) && t.Match != TagMatchRegex {
+		t.Name = NormalizeText(t.Name)
+	}
+}
+
+// isNormalized reports whether normalize would leave the tag's name as it is, ignoring case
+func (t Tag) isNormalized() bool {
+	n := t
+	n.normalize()
+	return strings.EqualFold(n.Name, t.Name)
+}
+
+// compile checks the tag's conditions and prepares it for matching
+func (t *Tag) compile() (*tagMatcher, error) {
+	m := &tagMatcher{tag: t, name: foldText(t.Name)}
+	switch t.Field {
+	case "", TagFieldTag, TagFieldDescription, TagFieldRawHint:
+	default:
+		return nil, fmt.Errorf("tag %q: unknown field %q, expected tag, description or rawhint", t.Name, t.Field)
+	}
+	switch t.Match {
+	case "", TagMatchPrefix, TagMatchContains:
+	case TagMatchRegex:
+		re, err := regexp.Compile("(?i)" + t.Name)
+		if err != nil {
+			return nil, fmt.Errorf("tag %q: invalid regex: %w", t.Name, err)
+		}
+		m.re = re
+	default:
+		return nil, fmt.Errorf("tag %q: unknown match %q, expected prefix, contains or regex", t.Name, t.Match)
+	}
+	switch t.Sign {
+	case "", TagSignExpense, TagSignCredit:
+	default:
+		return nil, fmt.Errorf("tag %q: unknown sign %q, expected expense or credit", t.Name, t.Sign)
+	}
+	if t.MinAmount < 0 || t.MaxAmount < 0 || t.MaxAmount != 0 && t.MaxAmount < t.MinAmount {
+		return nil, fmt.Errorf("tag %q: amount range %d..%d isn't a range of sizes", t.Name, t.MinAmount, t.MaxAmount)
+	}
+	if t.MinDay < 0 || t.MaxDay > 31 || t.MaxDay != 0 && t.MaxDay < t.MinDay {
+		return nil, fmt.Errorf("tag %q: days of the month must be a range within 1..31", t.Name)
+	}
+	return m, nil
+}
+
+// matches reports whether a raw transaction meets all the tag's conditions,
+// ignoring case and runs of whitespace,
+// and how many bytes of its text the tag's name matched
+func (m *tagMatcher) matches(raw *RawTransaction) (int, bool) {
+	t := m.tag
+	if t.Account != "" && t.Account != raw.Account {
+		return 0, false
+	}
+	switch t.Sign {
+	case TagSignExpense:
+		if raw.Amount <= 0 {
+			return 0, false
+		}
+	case TagSignCredit:
+		if raw.Amount >= 0 {
+			return 0, false
+		}
+	}
+	size := raw.Amount
+	if size < 0 {
+		size = -size
+	}
+	if size < t.MinAmount || t.MaxAmount != 0 && size > t.MaxAmount {
+		return 0, false
+	}
+	if t.MinDay != 0 || t.MaxDay != 0 {
+		day := dayOfMonth(raw.PostedDate)
+		if day == 0 || t.MinDay != 0 && day < t.MinDay || t.MaxDay != 0 && day > t.MaxDay {
+			return 0, false
+		}
+	}
+
+	var text string
+	switch t.Field {
+	case TagFieldDescription:
+		text = raw.Description
+	case TagFieldRawHint:
+		text = raw.RawHint
+	default:
+		text = raw.Tag
+	}
+	switch t.Match {
+	case TagMatchContains:
+		return len(m.name), strings.Contains(foldText(text), m.name)
+	case TagMatchRegex:
+		loc := m.re.FindStringIndex(text)
+		if loc == nil {
+			return 0, false
+		}
+		return loc[1] - loc[0], true
+	default:
+		return len(m.name), strings.HasPrefix(foldText(text), m.name)
+	}
+}
+
+// dayOfMonth is the day of a YYYY-MM-DD date, 0 if it isn't one
+func dayOfMonth(d Date) int {
+	if len(d) != 10 || d[8] < '0' || d[8] > '9' || d[9] < '0' || d[9] > '9' {
+		return 0
+	}
+	return int(d[8]-'0')*10 + int(d[9]-'0')
+}
+
+// TagCandidate is a tag that matched a raw transaction
+type TagCandidate struct {
+	Tag         string // Name of the tag
+	Budget      string
+	Beneficiary string
+	Priority    int
+	Length      int // Bytes of text the tag's name matched
+}
+
+// TagConflict is a raw transaction matched by tags of the same priority that
+// would give it different budgets or beneficiaries.  The tag matching the
+// most text was chosen, but the tags should be made to agree.
+type TagConflict struct {
+	RawTransactionID uint
+	Description      string
+	Tag              string // The raw transaction's tag
+	Chosen           TagCandidate
+	Others           []TagCandidate
+}
+
+// ApplyTagsResult says what ApplyTags did
+type ApplyTagsResult struct {
+	Message   string
+	Budgeted  int64 // Raw transactions given a budget by a tag or the check register
+	Conflicts []TagConflict
+}
+
+// better reports whether candidate a beats b: higher priority, then longer match, then name
+func (a *TagCandidate) better(b *TagCandidate) bool {
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+	if a.Length != b.Length {
+		return a.Length > b.Length
+	}
+	return a.Tag < b.Tag
+}
+
+// applyTagRules gives raw transactions the budget, and beneficiary if it has
+// one, of the best tag they match: the highest priority, then the one that
+// matched the most text.  A tag that matched no text, like the catch-all "",
+// only wins when nothing else matches and never conflicts.
+// exclude is an SQL condition on raw_transactions for rows to leave alone.
+// It returns the number of raw transactions that matched a tag, and the conflicts.
+func applyTagRules(tx *gorm.DB, exclude string) (int64, []TagConflict, error) {
+	matchers, err := loadTagMatchers(tx)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var raws []RawTransaction
+	err = tx.Select("id", "account", "posted_date", "amount", "description", "tag", "raw_hint", "budget", "beneficiary").
+		Where("NOT (" + exclude + ")").Order("id").Find(&raws).Error
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var matched int64
+	var conflicts []TagConflict
+	for i := range raws {
+		raw := &raws[i]
+		candidates, best := chooseTag(matchers, raw)
+		if best < 0 {
+			continue
+		}
+		chosen := candidates[best]
+		matched++
+
+		var others []TagCandidate
+		for j, c := range candidates {
+			if j != best && c.Priority == chosen.Priority && c.Length > 0 && chosen.Length > 0 &&
+				(c.Budget != chosen.Budget || c.Beneficiary != chosen.Beneficiary) {
+				others = append(others, c)
+			}
+		}
+		if len(others) > 0 {
+			conflicts = append(conflicts, TagConflict{
+				RawTransactionID: raw.ID, Description: raw.Description, Tag: raw.Tag, Chosen: chosen, Others: others,
+			})
+		}
+
+		updates := map[string]any{}
+		if chosen.Budget != raw.Budget {
+			updates["budget"] = chosen.Budget
+		}
+		if chosen.Beneficiary != "" && chosen.Beneficiary != raw.Beneficiary {
+			updates["beneficiary"] = chosen.Beneficiary
+		}
+		if len(updates) > 0 {
+			if err := tx.Model(&RawTransaction{}).Where("id = ?", raw.ID).Updates(updates).Error; err != nil {
+				return 0, nil, err
+			}
+		}
+	}
+	return matched, conflicts, nil
+}
+
+// loadTagMatchers compiles every tag, highest priority first
+func loadTagMatchers(tx *gorm.DB) ([]*tagMatcher, error) {
+	var tags []Tag
+	if err := tx.Order("priority DESC, name, id").Find(&tags).Error; err != nil {
+		return nil, err
+	}
+	matchers := make([]*tagMatcher, len(tags))
+	for i := range tags {
+		m, err := tags[i].compile()
+		if err != nil {
+			return nil, err
+		}
+		matchers[i] = m
+	}
+	return matchers, nil
+}
+
+// chooseTag returns the tags a raw transaction matches and the index of the
+// best of them, -1 if it matches none
+func chooseTag(matchers []*tagMatcher, raw *RawTransaction) ([]TagCandidate, int) {
+	var candidates []TagCandidate
+	best := -1
+	for _, m := range matchers {
+		length, ok := m.matches(raw)
+		if !ok {
+			continue
+		}
+		candidates = append(candidates, TagCandidate{
+			Tag: m.tag.Name, Budget: m.tag.Budget, Beneficiary: m.tag.Beneficiary, Priority: m.tag.Priority, Length: length,
+		})
+		if best < 0 || candidates[len(candidates)-1].better(&candidates[best]) {
+			best = len(candidates) - 1
+		}
+	}
+	return candidates, best
+}
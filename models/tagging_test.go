@@ -0,0 +1,164 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyTags_Rules(t *testing.T) {
+	s := SetupTestService(t)
+	require.NoError(t, s.Clean())
+	for _, name := range []string{"Groceries", "Dining", "Rent", "Salary", "Fuel", "Refunds"} {
+		require.NoError(t, s.AddBudget(&Budget{Name: name, Beneficiary: "Us"}))
+	}
+
+	for _, tag := range []Tag{
+		{Name: "kroger", Budget: "Groceries"},
+		{Name: "kroger fuel", Budget: "Fuel"}, // Wins over its prefix "kroger", the longer match
+		{Name: "Dining", Field: TagFieldRawHint, Match: TagMatchContains, Budget: "Dining", Beneficiary: "Bob", Account: "CapitalOne"},
+		{Name: `(?i)^ach .*landlord`, Field: TagFieldDescription, Match: TagMatchRegex, Budget: "Rent",
+			MinAmount: 100000, MaxAmount: 300000, Sign: TagSignExpense, MinDay: 1, MaxDay: 5},
+		{Name: "ACME PAYROLL", Field: TagFieldDescription, Budget: "Salary", Sign: TagSignCredit},
+		{Name: "amazon", Budget: "Refunds", Sign: TagSignCredit},
+	} {
+		require.NoError(t, s.AddTag(&tag))
+	}
+
+	for _, raw := range []RawTransaction{
+		{PostedDate: "2026-01-03", Account: "WfVisa", Amount: 4500, Description: "kroger #123"},
+		{PostedDate: "2026-01-03", Account: "WfVisa", Amount: 3000, Description: "kroger fuel #9"},
+		{PostedDate: "2026-01-04", Account: "CapitalOne", Amount: 2500, Description: "THE DINER", RawHint: "Dining", Beneficiary: "Us"},
+		{PostedDate: "2026-01-04", Account: "WfVisa", Amount: 2500, Description: "THE DINER", RawHint: "Dining", Beneficiary: "Us"},
+		{PostedDate: "2026-01-02", Account: "WfChecking", Amount: 180000, Description: "ACH DEBIT LANDLORD LLC"},
+		{PostedDate: "2026-01-12", Account: "WfChecking", Amount: 180000, Description: "ACH DEBIT LANDLORD LLC"}, // Too late in the month
+		{PostedDate: "2026-01-15", Account: "WfChecking", Amount: -350000, Description: "ACME PAYROLL"},
+		{PostedDate: "2026-01-16", Account: "WfVisa", Amount: -1999, Description: "amazon mktp"},
+		{PostedDate: "2026-01-16", Account: "WfVisa", Amount: 1999, Description: "amazon mktp"},
+	} {
+		require.NoError(t, s.AddRawTransaction(&raw))
+	}
+
+	result, err := s.ApplyTags()
+	require.NoError(t, err)
+
+	raws, err := s.GetRawTransactions()
+	require.NoError(t, err)
+	var got [][3]string
+	for _, raw := range raws {
+		got = append(got, [3]string{raw.Description, raw.Budget, raw.Beneficiary})
+	}
+	assert.Equal(t, [][3]string{
+		{"kroger #123", "Groceries", ""},
+		{"kroger fuel #9", "Fuel", ""},
+		{"THE DINER", "Dining", "Bob"},
+		{"THE DINER", PLACEHOLDER_BUDGET, "Us"}, // The seeded "" tag matches anything else
+		{"ACH DEBIT LANDLORD LLC", "Rent", ""},
+		{"ACH DEBIT LANDLORD LLC", PLACEHOLDER_BUDGET, ""},
+		{"ACME PAYROLL", "Salary", ""},
+		{"amazon mktp", "Refunds", ""},
+		{"amazon mktp", PLACEHOLDER_BUDGET, ""},
+	}, got)
+	assert.Equal(t, int64(len(raws)), result.Budgeted)
+	require.Len(t, result.Conflicts, 1)
+	assert.Equal(t, "kroger fuel #9", result.Conflicts[0].Description)
+	assert.Equal(t, []TagCandidate{{Tag: "kroger", Budget: "Groceries", Length: 6}}, result.Conflicts[0].Others)
+}
+
+func TestApplyTags_Priority(t *testing.T) {
+	s := SetupTestService(t)
+	require.NoError(t, s.Clean())
+	for _, name := range []string{"Shopping", "Streaming", "Books"} {
+		require.NoError(t, s.AddBudget(&Budget{Name: name, Beneficiary: "Us"}))
+	}
+
+	for _, tag := range []Tag{
+		{Name: "amazon", Budget: "Shopping"},
+		{Name: "amazon prime", Budget: "Streaming"},
+		{Name: "amazon prime video", Budget: "Streaming"}, // Agrees with "amazon prime", so no conflict with it
+		{Name: "KINDLE", Field: TagFieldDescription, Match: TagMatchContains, Budget: "Books", Priority: 1},
+	} {
+		require.NoError(t, s.AddTag(&tag))
+	}
+	for _, raw := range []RawTransaction{
+		{PostedDate: "2026-02-01", Account: "WfVisa", Amount: 1499, Description: "amazon prime video"},
+		{PostedDate: "2026-02-02", Account: "WfVisa", Amount: 999, Description: "amazon prime KINDLE UNLTD"},
+		{PostedDate: "2026-02-03", Account: "WfVisa", Amount: 2500, Description: "amazon mktp"},
+	} {
+		require.NoError(t, s.AddRawTransaction(&raw))
+	}
+
+	result, err := s.ApplyTags()
+	require.NoError(t, err)
+
+	raws, err := s.GetRawTransactions()
+	require.NoError(t, err)
+	var got []string
+	for _, raw := range raws {
+		got = append(got, raw.Budget)
+	}
+	assert.Equal(t, []string{"Streaming", "Books", "Shopping"}, got) // KINDLE's priority beats the longer match
+
+	require.Len(t, result.Conflicts, 1)
+	c := result.Conflicts[0]
+	assert.Equal(t, raws[0].ID, c.RawTransactionID)
+	assert.Equal(t, TagCandidate{Tag: "amazon prime video", Budget: "Streaming", Length: 18}, c.Chosen)
+	assert.Equal(t, []TagCandidate{{Tag: "amazon", Budget: "Shopping", Length: 6}}, c.Others)
+	assert.Equal(t, "Auto-applied budgets for 3 transactions. 1 matched tags with different budgets; the longest match was used.", result.Message)
+}
+
+func TestAddTag_Invalid(t *testing.T) {
+	s := SetupTestService(t)
+	require.NoError(t, s.Clean())
+
+	for _, tag := range []Tag{
+		{Name: "(", Match: TagMatchRegex},
+		{Name: "x", Match: "glob"},
+		{Name: "x", Field: "memo"},
+		{Name: "x", Sign: "debit"},
+		{Name: "x", MinAmount: 500, MaxAmount: 100},
+		{Name: "x", MinDay: 20, MaxDay: 10},
+		{Name: "x", MaxDay: 32},
+	} {
+		assert.Error(t, s.AddTag(&tag), "%+v", tag)
+	}
+}
+
+func TestAddTag_SharedNames(t *testing.T) {
+	s := SetupTestService(t)
+	require.NoError(t, s.Clean())
+	for _, name := range []string{"Shopping", "Books", "Dining"} {
+		require.NoError(t, s.AddBudget(&Budget{Name: name, Beneficiary: "Us"}))
+	}
+
+	for _, tag := range []Tag{
+		{Name: "amazon", Budget: "Shopping", Account: "WfVisa"},
+		{Name: "amazon", Budget: "Books", Account: "WfChecking"},
+		{Name: "dining", Budget: "Dining"},
+		{Name: "Dining", Field: TagFieldRawHint, Budget: "Dining", Beneficiary: "Bob"},
+	} {
+		require.NoError(t, s.AddTag(&tag), tag.Name)
+		assert.NotZero(t, tag.ID)
+	}
+	assert.Error(t, s.AddTag(&Tag{Name: "AMAZON", Budget: "Books", Account: "WfChecking"})) // The same rule
+
+	for _, raw := range []RawTransaction{
+		{PostedDate: "2026-02-01", Account: "WfVisa", Amount: 2500, Description: "amazon mktp"},
+		{PostedDate: "2026-02-01", Account: "WfChecking", Amount: 1200, Description: "amazon mktp"},
+		{PostedDate: "2026-02-02", Account: "CapitalOne", Amount: 3000, Description: "THE DINER", RawHint: "Dining"},
+		{PostedDate: "2026-02-02", Account: "WfVisa", Amount: 900, Description: "DINING HALL"},
+	} {
+		require.NoError(t, s.AddRawTransaction(&raw))
+	}
+	_, err := s.ApplyTags()
+	require.NoError(t, err)
+
+	raws, err := s.GetRawTransactions()
+	require.NoError(t, err)
+	var got [][2]string
+	for _, raw := range raws {
+		got = append(got, [2]string{raw.Budget, raw.Beneficiary})
+	}
+	assert.Equal(t, [][2]string{{"Shopping", ""}, {"Books", ""}, {"Dining", "Bob"}, {"Dining", ""}}, got)
+}
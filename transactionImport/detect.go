@@ -0,0 +1,285 @@
+package transactionImport
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"wailts/models"
+
+	"gorm.io/gorm"
+)
+
+// Format detection settings.  A file is assigned to the best scoring account
+// only if it scores at least MinDetectScore and beats the runner up by
+// more than DetectMargin.
+var (
+	MinDetectScore = 0.8
+	DetectMargin   = 0.05
+)
+
+// detectSampleLines is how much of a file is read to guess its format
+const detectSampleLines = 50
+
+// FormatMatch is how well a file fits the download format of one account
+type FormatMatch struct {
+	Account    string
+	Score      float64 // 0 (can't be this account's format) .. 1 (fits perfectly)
+	Reason     string  // Why the score isn't perfect, if it isn't
+	Identified bool    // The file's name or the account number in it says it's this account's
+}
+
+// DetectAccount works out which account a downloaded file came from,
+// by scoring the start of the file against every account's parser.
+// Of the accounts that fit, those the file identifies, by the account
+// number in it or the account's FilePattern, are preferred, since many
+// accounts share a format.
+// It returns the proposed account and the scores of all accounts, best first.
+// If no account fits well enough, or the best fits are too close to call,
+// the proposed account is empty and the error says why.
+func DetectAccount(db *gorm.DB, filePath string) (string, []FormatMatch, error) {
+	sample, err := readSample(filePath)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var accounts []models.Account
+	if err := db.Order("name").Find(&accounts).Error; err != nil {
+		return "", nil, err
+	}
+
+	stated := statedAccounts(filePath, sample)
+	var matches []FormatMatch
+	for _, account := range accounts {
+		parser, err := GetParser(db, account.Name, filePath)
+		if err != nil {
+			continue // No format for this account, so nothing to compare
+		}
+		m := scoreFormat(account.Name, parser, sample)
+		m.Identified = identifies(&account, filePath, stated)
+		matches = append(matches, m)
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+
+	var fits, identified []FormatMatch
+	for _, m := range matches {
+		if m.Score >= MinDetectScore {
+			fits = append(fits, m)
+			if m.Identified {
+				identified = append(identified, m)
+			}
+		}
+	}
+	if len(identified) > 0 {
+		fits = identified
+	}
+	switch {
+	case len(fits) == 0:
+		return "", matches, errors.New("the file doesn't match any account's download format")
+	case len(fits) > 1 && fits[0].Score-fits[1].Score <= DetectMargin:
+		return "", matches, fmt.Errorf("the file matches both %s and %s, choose the account, "+
+			"or give the accounts numbers or file patterns to tell them apart", fits[0].Account, fits[1].Account)
+	}
+	return fits[0].Account, matches, nil
+}
+
+// identifies reports whether a file's name fits an account's FilePattern, or
+// the file states the account's name or number
+func identifies(account *models.Account, filePath string, stated []string) bool {
+	if account.FilePattern != "" {
+		if ok, _ := filepath.Match(strings.ToLower(account.FilePattern), strings.ToLower(filepath.Base(filePath))); ok {
+			return true
+		}
+	}
+	for _, s := range stated {
+		if strings.EqualFold(s, account.Name) || account.Number != "" && accountNumberMatches(s, account.Number) {
+			return true
+		}
+	}
+	return false
+}
+
+// statedAccounts returns the accounts a sample of an OFX or QIF file says it's
+// for: OFX ACCTIDs, and the names of QIF !Account records
+func statedAccounts(filePath string, sample []byte) []string {
+	var stated []string
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".ofx", ".qfx":
+		s := newOFXScanner(bytes.NewReader(sample))
+		for s.scan() {
+			if s.name == "ACCTID" && !s.closing {
+				stated = append(stated, strings.TrimSpace(s.text))
+			}
+		}
+	case ".qif":
+		inAccount := false
+		for _, line := range strings.Split(string(sample), "\n") {
+			line = strings.TrimSpace(line)
+			switch {
+			case strings.HasPrefix(line, "!"):
+				inAccount = strings.EqualFold(line, "!Account")
+			case inAccount && strings.HasPrefix(line, "N"):
+				stated = append(stated, line[1:])
+			}
+		}
+	}
+	return stated
+}
+
+// maxPDFSample is the largest PDF read whole to detect its account
+const maxPDFSample = 16 << 20
+
+// readSample returns the first lines of a file, or the whole of a PDF, which has no lines
+func readSample(filePath string) ([]byte, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if strings.EqualFold(filepath.Ext(filePath), ".pdf") {
+		return io.ReadAll(io.LimitReader(f, maxPDFSample))
+	}
+
+	var sample bytes.Buffer
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for i := 0; i < detectSampleLines && scanner.Scan(); i++ {
+		sample.Write(scanner.Bytes())
+		sample.WriteByte('\n')
+	}
+	return sample.Bytes(), scanner.Err()
+}
+
+// scoreFormat parses a sample with an account's parser.  The score is the fraction
+// of rows accepted, reduced if the sample's header or card numbers don't look like
+// what the format expects.
+func scoreFormat(account string, parser Parser, sample []byte) FormatMatch {
+	m := FormatMatch{Account: account}
+	result, err := ParseAll(parser, bytes.NewReader(sample))
+	if err != nil {
+		m.Reason = err.Error()
+		return m
+	}
+	total := len(result.Accepted) + len(result.Rejected)
+	if total == 0 {
+		m.Reason = "no transactions found"
+		return m
+	}
+	m.Score = float64(len(result.Accepted)) / float64(total)
+	if len(result.Rejected) > 0 {
+		m.Reason = fmt.Sprintf("%d of %d rows rejected, e.g. line %d: %s",
+			len(result.Rejected), total, result.Rejected[0].Line, result.Rejected[0].Reason)
+	}
+
+	if p, ok := parser.(*CSVParser); ok {
+		if factor, reason := p.sniff(sample); factor < 1 {
+			m.Score *= factor
+			m.Reason = reason
+		}
+	}
+	return m
+}
+
+// sniff checks the parts of a sample that parsing alone doesn't: a format with
+// a header row shouldn't be reading a file whose first row is data, and card
+// numbers should look like card numbers.  It returns a factor to scale the score by.
+func (p *CSVParser) sniff(sample []byte) (float64, string) {
+	f := &p.Format
+	r := csv.NewReader(bytes.NewReader(sample))
+	r.FieldsPerRecord = -1
+	rows, err := r.ReadAll()
+	if err != nil && len(rows) == 0 {
+		return 0, err.Error()
+	}
+	if len(rows) <= f.HeaderRows {
+		return 0, "no rows after the header"
+	}
+
+	var header []string
+	if f.HeaderRows > 0 {
+		header = rows[f.HeaderRows-1]
+	}
+	cols, err := resolveColumns(f, header)
+	if err != nil {
+		return 0, err.Error()
+	}
+
+	if f.HeaderRows > 0 {
+		if _, err := parseDate(field(header, cols.postedDate), dateLayouts(f)); err == nil {
+			return 0, "expected a header row, but the first row is data"
+		}
+	}
+
+	if cols.card >= 0 {
+		data := rows[f.HeaderRows:]
+		cards := 0
+		for _, row := range data {
+			if looksLikeCardNumber(field(row, cols.card)) {
+				cards++
+			}
+		}
+		if cards < len(data) {
+			return float64(cards) / float64(len(data)), fmt.Sprintf("%d of %d rows have no card number", len(data)-cards, len(data))
+		}
+	}
+	return 1, ""
+}
+
+// looksLikeCardNumber accepts digits, possibly masked ("XXXX-1234", "*1234")
+func looksLikeCardNumber(s string) bool {
+	s = strings.TrimSpace(s)
+	digits := 0
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case strings.ContainsRune("xX*-. ", r):
+		default:
+			return false
+		}
+	}
+	return digits >= 4
+}
+
+// accountNumberMatches reports whether the account a file states, often masked
+// ("XXXXXX1234"), is an account's number, or ends with the last digits the account has
+func accountNumberMatches(stated, number string) bool {
+	clean := func(s string) string {
+		s = strings.ToUpper(strings.Map(func(r rune) rune {
+			if r == ' ' || r == '-' {
+				return -1
+			}
+			return r
+		}, s))
+		return strings.TrimLeft(s, "X*")
+	}
+	stated, number = clean(stated), clean(number)
+	if stated == "" || number == "" {
+		return false
+	}
+	if stated == number {
+		return true
+	}
+	if min(len(stated), len(number)) < 4 {
+		return false
+	}
+	return strings.HasSuffix(stated, number) || strings.HasSuffix(number, stated)
+}
+
+// noTransactionsFor is the error for a file whose transactions are all for other accounts
+func noTransactionsFor(account string, others map[string]bool) error {
+	var names []string
+	for name := range others {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return fmt.Errorf("no transactions for account %s, the file has accounts %s", account, strings.Join(names, ", "))
+}
@@ -0,0 +1,124 @@
+package transactionImport
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"wailts/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+// firstLines returns the first n lines of a sample file
+func firstLines(s string, n int) string {
+	return strings.Join(strings.Split(s, "\n")[:n], "\n") + "\n"
+}
+
+func TestDetectAccount(t *testing.T) {
+	s := setupTestService(t)
+
+	// Header and the 3 good rows
+	account, matches, err := DetectAccount(s.DB, writeFile(t, "transaction_download.csv", firstLines(capitalOneCSV, 4)))
+	require.NoError(t, err)
+	assert.Equal(t, "CapitalOne", account)
+	require.Len(t, matches, 3)
+	assert.Equal(t, "CapitalOne", matches[0].Account)
+	assert.Equal(t, 1.0, matches[0].Score)
+	assert.Zero(t, matches[1].Score)
+
+	// Too many bad rows to be sure
+	_, matches, err = DetectAccount(s.DB, writeFile(t, "transaction_download.csv", capitalOneCSV))
+	assert.Error(t, err)
+	assert.Less(t, matches[0].Score, MinDetectScore, "2 of 5 sample rows are bad")
+
+	// Checking and Visa downloads look the same, but Wells Fargo names them differently
+	account, matches, err = DetectAccount(s.DB, writeFile(t, "Checking1.csv", firstLines(wellsFargoCSV, 3)))
+	require.NoError(t, err)
+	assert.Equal(t, "WfChecking", account)
+	assert.Equal(t, matches[0].Score, matches[1].Score)
+	account, _, err = DetectAccount(s.DB, writeFile(t, "CreditCard1.csv", firstLines(wellsFargoCSV, 3)))
+	require.NoError(t, err)
+	assert.Equal(t, "WfVisa", account)
+	_, _, err = DetectAccount(s.DB, writeFile(t, "renamed.csv", firstLines(wellsFargoCSV, 3)))
+	assert.ErrorContains(t, err, "matches both WfChecking and WfVisa")
+
+	_, _, err = DetectAccount(s.DB, writeFile(t, "notes.csv", "hello,world\nnot,a,download\n"))
+	assert.ErrorContains(t, err, "doesn't match any account")
+}
+
+func TestDetectAccount_Numbers(t *testing.T) {
+	s := setupTestService(t)
+	require.NoError(t, s.DB.Model(&models.Account{}).Where("name = ?", "WfChecking").Update("number", "1234").Error)
+
+	// Every account reads OFX, but the statement is for account ...1234
+	ofx := strings.Replace(ofxSGML, "<CURDEF>USD\n", "<CURDEF>USD\n<BANKACCTFROM><BANKID>121000248<ACCTID>XXXXXX1234<ACCTTYPE>CHECKING</BANKACCTFROM>\n", 1)
+	account, matches, err := DetectAccount(s.DB, writeFile(t, "statement.ofx", ofx))
+	require.NoError(t, err)
+	assert.Equal(t, "WfChecking", account)
+	for _, m := range matches {
+		assert.Equal(t, m.Account == "WfChecking", m.Identified, m.Account)
+	}
+	_, _, err = DetectAccount(s.DB, writeFile(t, "statement.ofx", ofxSGML))
+	assert.ErrorContains(t, err, "matches both", "no ACCTID to go on")
+
+	// The QIF file names its accounts, which needn't be the app's names
+	require.NoError(t, s.DB.Model(&models.Account{}).Where("name = ?", "WfChecking").Update("number", "Checking").Error)
+	account, _, err = DetectAccount(s.DB, writeFile(t, "export.qif", qifExport))
+	require.NoError(t, err)
+	assert.Equal(t, "WfChecking", account)
+}
+
+func TestAccountNumberMatches(t *testing.T) {
+	assert.True(t, accountNumberMatches("XXXXXX1234", "1234"))
+	assert.True(t, accountNumberMatches("1234", "9876-5432-1234"))
+	assert.True(t, accountNumberMatches("****-1234", "1234"))
+	assert.True(t, accountNumberMatches("visa", "Visa"))
+	assert.False(t, accountNumberMatches("XXXXXX1234", "5678"))
+	assert.False(t, accountNumberMatches("34", "1234"), "too few digits to go on")
+	assert.False(t, accountNumberMatches("", "1234"))
+}
+
+func TestDetectAccount_HeaderAndCards(t *testing.T) {
+	s := setupTestService(t)
+	require.NoError(t, s.DB.Delete(&models.Account{}, "name IN ?", []string{"WfChecking", "WfVisa"}).Error)
+
+	// CapitalOne layout without its header row
+	noHeader := "2025-12-20,2025-12-22,3028,KROGER,Groceries,1.00,\n2025-12-21,2025-12-22,3028,SAFEWAY,Groceries,2.00,\n"
+	_, matches, err := DetectAccount(s.DB, writeFile(t, "a.csv", noHeader))
+	assert.Error(t, err)
+	assert.Zero(t, matches[0].Score)
+	assert.Contains(t, matches[0].Reason, "first row is data")
+
+	// Something in the card column that isn't a card number
+	noCards := "Transaction Date,Posted Date,Card No.,Description,Category,Debit,Credit\n" +
+		"2025-12-20,2025-12-22,Bob,KROGER,Groceries,1.00,\n2025-12-21,2025-12-22,3028,SAFEWAY,Groceries,2.00,\n"
+	_, matches, err = DetectAccount(s.DB, writeFile(t, "b.csv", noCards))
+	assert.Error(t, err)
+	assert.InDelta(t, 0.5, matches[0].Score, 0.001)
+	assert.Contains(t, matches[0].Reason, "1 of 2 rows have no card number")
+}
+
+func TestImporter_DetectsAccount(t *testing.T) {
+	s := setupTestService(t)
+	im := &Importer{DB: s.DB, ArchiveDir: t.TempDir()}
+
+	good := "Transaction Date,Posted Date,Card No.,Description,Category,Debit,Credit\n" +
+		"2025-12-20,2025-12-22,3028,KROGER,Groceries,1.00,\n"
+	report, err := im.ImportFile("", writeFile(t, "download.csv", good), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "CapitalOne", report.Account)
+
+	raws, err := s.GetRawTransactions()
+	require.NoError(t, err)
+	require.Len(t, raws, 1)
+	assert.Equal(t, "CapitalOne", raws[0].Account)
+}
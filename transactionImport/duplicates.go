@@ -0,0 +1,110 @@
+package transactionImport
+
+import (
+	"strings"
+	"time"
+	"unicode"
+	"wailts/models"
+)
+
+// Fuzzy duplicate detection settings.
+// A probable duplicate has the same amount, a posted date no more than
+// DuplicateWindowDays away and a similar description; its confidence
+// must reach MinDuplicateConfidence to be flagged.
+var (
+	DuplicateWindowDays    = 3
+	MinDuplicateConfidence = 0.5
+)
+
+// duplicateCandidate is an existing row that an incoming one may duplicate,
+// either a Transaction or a RawTransaction
+type duplicateCandidate struct {
+	transactionID uint
+	rawID         uint
+	date          models.Date
+	amount        models.Money
+	description   string
+
+	day    time.Time
+	tokens map[string]bool
+}
+
+// duplicateFinder looks for probable duplicates among candidates with the same amount
+type duplicateFinder struct {
+	byAmount map[models.Money][]*duplicateCandidate
+}
+
+func newDuplicateFinder() *duplicateFinder {
+	return &duplicateFinder{byAmount: make(map[models.Money][]*duplicateCandidate)}
+}
+
+func (f *duplicateFinder) add(c duplicateCandidate) {
+	day, err := time.Parse("2006-01-02", string(c.date))
+	if err != nil {
+		return
+	}
+	c.day = day
+	c.tokens = descriptionTokens(c.description)
+	f.byAmount[c.amount] = append(f.byAmount[c.amount], &c)
+}
+
+// best returns the most likely duplicate of pt and the confidence (0..1) that it is one,
+// or nil if no candidate reaches MinDuplicateConfidence
+func (f *duplicateFinder) best(pt ParsedTransaction) (*duplicateCandidate, float64) {
+	day, err := time.Parse("2006-01-02", string(pt.PostedDate))
+	if err != nil {
+		return nil, 0
+	}
+	tokens := descriptionTokens(pt.Description)
+
+	var best *duplicateCandidate
+	bestConfidence := 0.0
+	for _, c := range f.byAmount[pt.Amount] {
+		days := int(day.Sub(c.day).Hours() / 24)
+		if days < 0 {
+			days = -days
+		}
+		if days > DuplicateWindowDays {
+			continue
+		}
+		// Same day is as good as it gets, one past the window would be worthless
+		nearness := 1 - float64(days)/float64(DuplicateWindowDays+1)
+		confidence := descriptionSimilarity(tokens, c.tokens) * nearness
+		if confidence > bestConfidence {
+			best, bestConfidence = c, confidence
+		}
+	}
+	if bestConfidence < MinDuplicateConfidence {
+		return nil, 0
+	}
+	return best, bestConfidence
+}
+
+// descriptionTokens splits a description into lower case words
+func descriptionTokens(desc string) map[string]bool {
+	tokens := make(map[string]bool)
+	for _, w := range strings.FieldsFunc(strings.ToLower(desc), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		tokens[w] = true
+	}
+	return tokens
+}
+
+// descriptionSimilarity is the fraction of the shorter description's words found in the longer one,
+// so a description the bank has shortened or added to still scores well
+func descriptionSimilarity(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	common := 0
+	for w := range a {
+		if b[w] {
+			common++
+		}
+	}
+	return float64(common) / float64(len(a))
+}
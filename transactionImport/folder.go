@@ -0,0 +1,243 @@
+package transactionImport
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"wailts/models"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// downloadExtensions are the files ImportFolder and the inbox watcher pick up
+var downloadExtensions = map[string]bool{".csv": true, ".ofx": true, ".qfx": true, ".qif": true, ".pdf": true}
+
+// WatchSettleTime is how long a new file in a watched folder must go unchanged
+// before it is imported, so a browser still writing a download isn't read half way.
+var WatchSettleTime = 2 * time.Second
+
+// Status of a file in a folder import
+const (
+	FileImporting = "importing"
+	FileImported  = "imported"
+	FileSkipped   = "skipped" // Already in the ledger of imported files
+	FileFailed    = "failed"
+)
+
+// FileProgress reports on one file of a folder import
+type FileProgress struct {
+	File    string
+	Index   int // 1-based position of the file in the folder, 0 when watching
+	Total   int // Number of files in the folder, 0 when watching
+	Status  string
+	Message string
+	Rows    int           // Rows of the file read so far, while importing
+	Percent float64       // Fraction of the file read so far, while importing
+	Report  *ImportReport // Set when Status is FileImported
+}
+
+// FolderReport sums up a folder import
+type FolderReport struct {
+	Message string
+	Files   []FileProgress // Final status of each file
+}
+
+// ImportFolder imports every download in a folder that hasn't been imported before,
+// detecting the account of each one.  A file is new if no ImportBatch has its
+// contents' hash, so renamed or moved copies aren't imported twice.
+// A file that fails is reported and skipped, the rest are still imported.
+// progress, if not nil, is called as each file starts and finishes.
+func (im *Importer) ImportFolder(dir string, progress func(FileProgress)) (*FolderReport, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		if e.Type().IsRegular() && isDownload(e.Name()) {
+			files = append(files, filepath.Join(dir, e.Name()))
+		}
+	}
+	sort.Strings(files)
+
+	report := &FolderReport{}
+	counts := make(map[string]int)
+	for i, path := range files {
+		p := FileProgress{File: path, Index: i + 1, Total: len(files)}
+		im.importNew(&p, progress)
+		report.Files = append(report.Files, p)
+		counts[p.Status]++
+	}
+	report.Message = fmt.Sprintf("Imported %d of %d files", counts[FileImported], len(files))
+	if counts[FileSkipped] > 0 {
+		report.Message += fmt.Sprintf(", skipped %d already imported", counts[FileSkipped])
+	}
+	if counts[FileFailed] > 0 {
+		report.Message += fmt.Sprintf(", %d failed", counts[FileFailed])
+	}
+	return report, nil
+}
+
+// importNew imports one file unless it is in the ledger, filling in p
+func (im *Importer) importNew(p *FileProgress, progress func(FileProgress)) {
+	notify := func() {
+		if progress != nil {
+			progress(*p)
+		}
+	}
+
+	imported, err := im.alreadyImported(p.File)
+	switch {
+	case err != nil:
+		p.Status, p.Message = FileFailed, err.Error()
+		notify()
+		return
+	case imported:
+		p.Status, p.Message = FileSkipped, "Already imported"
+		notify()
+		return
+	}
+
+	p.Status = FileImporting
+	notify()
+	report, err := im.ImportFile("", p.File, func(fp FileProgress) {
+		p.Rows, p.Percent = fp.Rows, fp.Percent
+		notify()
+	})
+	if err != nil {
+		p.Status, p.Message = FileFailed, err.Error()
+	} else {
+		p.Status, p.Message, p.Report = FileImported, fmt.Sprintf("%s into %s", report.Message, report.Account), report
+	}
+	notify()
+}
+
+// alreadyImported checks the ledger of imported files for the file's contents
+func (im *Importer) alreadyImported(path string) (bool, error) {
+	hash, err := hashFile(path)
+	if err != nil {
+		return false, err
+	}
+	var count int64
+	if err := im.DB.Model(&models.ImportBatch{}).Where("file_hash = ?", hash).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func isDownload(name string) bool {
+	return downloadExtensions[strings.ToLower(filepath.Ext(name))]
+}
+
+// Watcher imports downloads as they appear in a folder
+type Watcher struct {
+	im       *Importer
+	progress func(FileProgress)
+	watcher  *fsnotify.Watcher
+	done     chan struct{}
+
+	mu       sync.Mutex
+	pending  map[string]*time.Timer // Files waiting to settle
+	wg       sync.WaitGroup
+	importMu sync.Mutex // Imports one settled file at a time
+}
+
+// Watch starts importing new downloads that appear in dir.  Files already in dir
+// are not imported, use ImportFolder for those.  progress is called from the
+// watcher's goroutines; imports are done one at a time.
+func (im *Importer) Watch(dir string, progress func(FileProgress)) (*Watcher, error) {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := fw.Add(dir); err != nil {
+		fw.Close()
+		return nil, err
+	}
+	w := &Watcher{
+		im:       im,
+		progress: progress,
+		watcher:  fw,
+		done:     make(chan struct{}),
+		pending:  make(map[string]*time.Timer),
+	}
+	go w.run()
+	return w, nil
+}
+
+// Close stops watching and waits for an import in progress to finish
+func (w *Watcher) Close() error {
+	err := w.watcher.Close()
+	<-w.done
+
+	w.mu.Lock()
+	for path, t := range w.pending {
+		if t.Stop() {
+			w.wg.Done()
+		}
+		delete(w.pending, path)
+	}
+	w.mu.Unlock()
+	w.wg.Wait()
+	return err
+}
+
+func (w *Watcher) run() {
+	defer close(w.done)
+	for {
+		select {
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Has(fsnotify.Create) || event.Has(fsnotify.Write) || event.Has(fsnotify.Rename) {
+				if isDownload(event.Name) {
+					w.settle(event.Name)
+				}
+			}
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			if w.progress != nil {
+				w.progress(FileProgress{Status: FileFailed, Message: err.Error()})
+			}
+		}
+	}
+}
+
+// settle (re)starts the wait before a changed file is imported
+func (w *Watcher) settle(path string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if t, ok := w.pending[path]; ok && t.Stop() {
+		t.Reset(WatchSettleTime)
+		return
+	}
+	w.wg.Add(1)
+	var t *time.Timer
+	t = time.AfterFunc(WatchSettleTime, func() {
+		defer w.wg.Done()
+		w.mu.Lock()
+		if w.pending[path] == t {
+			delete(w.pending, path)
+		}
+		w.mu.Unlock()
+		w.importSettled(path)
+	})
+	w.pending[path] = t
+}
+
+func (w *Watcher) importSettled(path string) {
+	w.importMu.Lock()
+	defer w.importMu.Unlock()
+	if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+		return // Renamed away or deleted before it settled
+	}
+	p := FileProgress{File: path}
+	w.im.importNew(&p, w.progress)
+}
@@ -0,0 +1,124 @@
+package transactionImport
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"wailts/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const capitalOneDownload = "Transaction Date,Posted Date,Card No.,Description,Category,Debit,Credit\n" +
+	"2025-12-20,2025-12-22,3028,KROGER,Groceries,1.00,\n"
+
+func TestImportFolder(t *testing.T) {
+	s := setupTestService(t)
+	im := &Importer{DB: s.DB, ArchiveDir: t.TempDir()}
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.csv"), []byte(capitalOneDownload), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.csv"), []byte("hello,world\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte(capitalOneDownload), 0644))
+
+	var progress []FileProgress // Changes of status
+	report, err := im.ImportFolder(dir, func(p FileProgress) {
+		if len(progress) == 0 || progress[len(progress)-1].Status != p.Status {
+			progress = append(progress, p)
+		}
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Imported 1 of 2 files, 1 failed", report.Message)
+	require.Len(t, report.Files, 2)
+	assert.Equal(t, FileImported, report.Files[0].Status)
+	assert.Equal(t, "CapitalOne", report.Files[0].Report.Account)
+	assert.Equal(t, FileFailed, report.Files[1].Status)
+	assert.Contains(t, report.Files[1].Message, "doesn't match any account")
+
+	require.Len(t, progress, 4, "a start and an end for each file")
+	assert.Equal(t, FileImporting, progress[0].Status)
+	assert.Equal(t, 1, progress[0].Index)
+	assert.Equal(t, 2, progress[0].Total)
+
+	// The same download under another name is in the ledger already
+	require.NoError(t, os.Rename(filepath.Join(dir, "a.csv"), filepath.Join(dir, "c.csv")))
+	report, err = im.ImportFolder(dir, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "Imported 0 of 2 files, skipped 1 already imported, 1 failed", report.Message)
+
+	raws, err := s.GetRawTransactions()
+	require.NoError(t, err)
+	assert.Len(t, raws, 1)
+}
+
+func TestImportFolder_MixedDownloads(t *testing.T) {
+	s := setupTestService(t)
+	require.NoError(t, s.DB.Model(&models.Account{}).Where("name = ?", "WfVisa").Update("number", "9876").Error)
+	im := &Importer{DB: s.DB, ArchiveDir: t.TempDir()}
+
+	// Wells Fargo checking and card downloads look the same, and every account reads OFX
+	dir := t.TempDir()
+	visaOFX := strings.Replace(ofxXML, "<CURDEF>EUR</CURDEF>", "<CURDEF>EUR</CURDEF><CCACCTFROM><ACCTID>XXXX9876</ACCTID></CCACCTFROM>", 1)
+	for name, content := range map[string]string{
+		"Checking1.csv":   firstLines(wellsFargoCSV, 2),
+		"CreditCard1.csv": firstLines(wellsFargoCSV, 3),
+		"download.csv":    capitalOneDownload,
+		"statement.qfx":   visaOFX,
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+
+	report, err := im.ImportFolder(dir, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "Imported 4 of 4 files", report.Message)
+	accounts := map[string]string{}
+	for _, f := range report.Files {
+		require.Equal(t, FileImported, f.Status, f.Message)
+		accounts[filepath.Base(f.File)] = f.Report.Account
+	}
+	assert.Equal(t, map[string]string{
+		"Checking1.csv":   "WfChecking",
+		"CreditCard1.csv": "WfVisa",
+		"download.csv":    "CapitalOne",
+		"statement.qfx":   "WfVisa",
+	}, accounts)
+}
+
+func TestWatch(t *testing.T) {
+	s := setupTestService(t)
+	im := &Importer{DB: s.DB, ArchiveDir: t.TempDir()}
+
+	oldSettle := WatchSettleTime
+	WatchSettleTime = 50 * time.Millisecond
+	defer func() { WatchSettleTime = oldSettle }()
+
+	dir := t.TempDir()
+	done := make(chan FileProgress, 10)
+	w, err := im.Watch(dir, func(p FileProgress) {
+		if p.Status != FileImporting {
+			done <- p
+		}
+	})
+	require.NoError(t, err)
+	defer w.Close()
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ignored.txt"), []byte(capitalOneDownload), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "download.csv"), []byte(capitalOneDownload), 0644))
+
+	select {
+	case p := <-done:
+		assert.Equal(t, FileImported, p.Status, p.Message)
+		assert.Equal(t, filepath.Join(dir, "download.csv"), p.File)
+	case <-time.After(5 * time.Second):
+		t.Fatal("download was not imported")
+	}
+	require.NoError(t, w.Close())
+	assert.Empty(t, done, "only the download is imported")
+
+	batches, err := s.GetImportBatches()
+	require.NoError(t, err)
+	assert.Len(t, batches, 1)
+}
@@ -0,0 +1,70 @@
+package transactionImport
+
+import (
+	"fmt"
+	"wailts/models"
+
+	"gorm.io/gorm"
+)
+
+// BuiltinFormats are the import formats that ship with the app.
+// A row in the import_formats table with the same name takes precedence.
+var BuiltinFormats = []models.ImportFormat{
+	{
+		// Header: Transaction Date, Posted Date, Card No., Description, Category, Debit, Credit
+		Name:                  "CapitalOne",
+		Description:           "Capital One credit card CSV download",
+		HeaderRows:            1,
+		MinColumns:            7,
+		TransactionDateColumn: "0",
+		PostedDateColumn:      "1",
+		CardColumn:            "2",
+		DescriptionColumn:     "3",
+		RawHintColumn:         "4",
+		DebitColumn:           "5",
+		CreditColumn:          "6",
+		DefaultBeneficiary:    "Us",
+	},
+	{
+		// No header: Date, Amount, (ignored), Check number, Description
+		Name:               "WfChecking",
+		Description:        "Wells Fargo checking CSV download",
+		MinColumns:         5,
+		PostedDateColumn:   "0",
+		AmountColumn:       "1",
+		NegateAmount:       true,
+		DescriptionColumn:  "4",
+		CheckNumberColumn:  "3",
+		DefaultBeneficiary: "Us",
+	},
+	{
+		// Same layout as checking
+		Name:               "WfVisa",
+		Description:        "Wells Fargo credit card CSV download",
+		MinColumns:         5,
+		PostedDateColumn:   "0",
+		AmountColumn:       "1",
+		NegateAmount:       true,
+		DescriptionColumn:  "4",
+		DefaultBeneficiary: "Us",
+	},
+}
+
+// LookupFormat finds an import format by name, first in the DB, then among the BuiltinFormats.
+func LookupFormat(db *gorm.DB, name string) (*models.ImportFormat, error) {
+	var format models.ImportFormat
+	result := db.Where("name = ?", name).Limit(1).Find(&format)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return &format, nil
+	}
+	for i := range BuiltinFormats {
+		if BuiltinFormats[i].Name == name {
+			format = BuiltinFormats[i]
+			return &format, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown import format: %s", name)
+}
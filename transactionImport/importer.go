@@ -0,0 +1,236 @@
+package transactionImport
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+	"wailts/models"
+
+	"gorm.io/gorm"
+)
+
+// Importer imports whole files: it parses them, stages the transactions into
+// raw_transactions, keeps a copy of each file in the archive folder and
+// records an ImportBatch for every import.
+type Importer struct {
+	DB         *gorm.DB
+	ArchiveDir string // The configured importFolder
+}
+
+// ImportFile imports one file downloaded from an account.
+// If account is empty, it is detected from the file's contents.
+// Importing a file that has been imported before is allowed, since that just
+// refreshes the staged rows, but the report warns about it.
+// The file is read and staged a chunk at a time; progress, if not nil, is
+// called after each chunk.
+func (im *Importer) ImportFile(account string, filePath string, progress func(FileProgress)) (*ImportReport, error) {
+	plan, err := im.plan(account, filePath)
+	if err != nil {
+		return nil, err
+	}
+	report := &ImportReport{Account: plan.account, Warnings: plan.warnings}
+
+	// Keep one copy of each distinct file
+	archivePath := ""
+	archived := false
+	if len(plan.previous) > 0 {
+		archivePath = plan.previous[0].ArchivePath
+	}
+	if _, err := os.Stat(archivePath); archivePath == "" || err != nil {
+		if archivePath, err = archiveFile(filePath, im.ArchiveDir, plan.hash, time.Now()); err != nil {
+			return nil, fmt.Errorf("failed to archive %s: %w", filePath, err)
+		}
+		archived = true
+	}
+
+	batch := models.ImportBatch{
+		FileName:    filePath,
+		FileHash:    plan.hash,
+		ArchivePath: archivePath,
+		Account:     plan.account,
+	}
+	err = im.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&batch).Error; err != nil {
+			return err
+		}
+		processor := NewProcessor(tx, plan.account, batch.ID)
+		rejected, err := im.stream(plan.parser, processor, &batch, filePath, progress)
+		report.Rejected = rejected
+		if err != nil {
+			return err
+		}
+		return tx.Save(&batch).Error
+	})
+	if err != nil {
+		if archived {
+			os.Remove(archivePath)
+		}
+		return nil, err
+	}
+
+	report.BatchID = batch.ID
+	report.Accepted = batch.Accepted
+	report.Duplicates = batch.Duplicates
+	report.Message = fmt.Sprintf("Imported %d records", batch.Accepted)
+	if batch.Rejected > 0 {
+		report.Message += fmt.Sprintf(", rejected %d", batch.Rejected)
+	}
+	return report, nil
+}
+
+// importPlan is what an import works out before reading the file
+type importPlan struct {
+	account  string
+	hash     string
+	previous []models.ImportBatch // Earlier imports of the same file
+	parser   Parser
+	warnings []string
+}
+
+// plan detects the account if it isn't given, checks for earlier imports of the file and picks its parser
+func (im *Importer) plan(account string, filePath string) (*importPlan, error) {
+	hash, err := hashFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if account == "" {
+		if account, _, err = DetectAccount(im.DB, filePath); err != nil {
+			return nil, err
+		}
+	}
+
+	plan := &importPlan{account: account, hash: hash}
+	if err := im.DB.Where("file_hash = ?", hash).Order("id").Find(&plan.previous).Error; err != nil {
+		return nil, err
+	}
+	for _, b := range plan.previous {
+		plan.warnings = append(plan.warnings, fmt.Sprintf("This file was already imported into %s on %s (import #%d)",
+			b.Account, b.CreatedAt.Format("2006-01-02 15:04"), b.ID))
+	}
+
+	if plan.parser, err = GetParser(im.DB, account, filePath); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// stream parses a file and stages its transactions a chunk at a time,
+// counting them in batch and returning the rejected rows
+func (im *Importer) stream(parser Parser, processor *Processor, batch *models.ImportBatch,
+	filePath string, progress func(FileProgress)) ([]RejectedRow, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var size int64
+	if info, err := f.Stat(); err == nil {
+		size = info.Size()
+	}
+	counter := &countingReader{r: f}
+
+	var rejected []RejectedRow
+	chunk := make([]ParsedTransaction, 0, ProcessChunkSize)
+	flush := func() error {
+		if err := processor.Add(chunk); err != nil {
+			return err
+		}
+		chunk = chunk[:0]
+		if progress != nil {
+			p := FileProgress{File: filePath, Status: FileImporting, Rows: batch.Accepted + batch.Rejected}
+			if size > 0 {
+				p.Percent = float64(counter.n) / float64(size)
+			}
+			progress(p)
+		}
+		return nil
+	}
+
+	for row, err := range parser.Rows(counter) {
+		if err != nil {
+			return rejected, err
+		}
+		if row.Rejected != nil {
+			rejected = append(rejected, *row.Rejected)
+			batch.Rejected++
+			continue
+		}
+		row.Transaction.SourceFile = filePath
+		chunk = append(chunk, row.Transaction)
+		batch.Accepted++
+		if len(chunk) == ProcessChunkSize {
+			if err := flush(); err != nil {
+				return rejected, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return rejected, err
+	}
+
+	summary, err := processor.Finish()
+	if err != nil {
+		return rejected, err
+	}
+	batch.Added = summary.Added
+	batch.Updated = summary.Updated
+	batch.Duplicates = summary.Duplicates
+	return rejected, nil
+}
+
+// countingReader counts the bytes read through it, to report progress through a file
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// hashFile returns the hex SHA-256 of a file's contents
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// archiveFile copies a file into the archive folder, as <timestamp>_<hash prefix>_<name>
+func archiveFile(path string, archiveDir string, hash string, now time.Time) (string, error) {
+	if err := os.MkdirAll(archiveDir, 0755); err != nil {
+		return "", err
+	}
+	dest := filepath.Join(archiveDir, fmt.Sprintf("%s_%s_%s", now.Format("20060102-150405"), hash[:12], filepath.Base(path)))
+
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(out, src); err != nil {
+		out.Close()
+		os.Remove(dest)
+		return "", err
+	}
+	return dest, out.Close()
+}
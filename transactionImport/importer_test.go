@@ -0,0 +1,198 @@
+package transactionImport
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"wailts/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImporter_ImportFile(t *testing.T) {
+	s := setupTestService(t)
+	dir := t.TempDir()
+	im := &Importer{DB: s.DB, ArchiveDir: filepath.Join(dir, "importHistory")}
+
+	download := filepath.Join(dir, "Checking1.csv")
+	require.NoError(t, os.WriteFile(download, []byte(wellsFargoCSV), 0644))
+
+	report, err := im.ImportFile("WfChecking", download, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "Imported 3 records, rejected 1", report.Message)
+	assert.Empty(t, report.Warnings)
+	assert.Len(t, report.Rejected, 1)
+
+	batch, err := models.GetByID[models.ImportBatch](s.DB, report.BatchID)
+	require.NoError(t, err)
+	assert.Equal(t, download, batch.FileName)
+	assert.Equal(t, "WfChecking", batch.Account)
+	assert.Len(t, batch.FileHash, 64)
+	assert.Equal(t, 3, batch.Accepted)
+	assert.Equal(t, 1, batch.Rejected)
+	assert.Equal(t, 3, batch.Added)
+	assert.Equal(t, 0, batch.Updated)
+
+	raws, err := s.GetRawTransactions()
+	require.NoError(t, err)
+	for _, r := range raws {
+		require.NotNil(t, r.ImportBatchID)
+		assert.Equal(t, batch.ID, *r.ImportBatchID)
+		assert.Equal(t, download, r.SourceFile)
+	}
+	assert.Equal(t, 3, raws[2].SourceLine)
+	assert.JSONEq(t, `{"0":"12/03/2025","1":"-100.00","2":"*","3":"1234","4":"CHECK # 1234"}`, raws[2].SourceRow)
+
+	archived, err := os.ReadFile(batch.ArchivePath)
+	require.NoError(t, err)
+	assert.Equal(t, wellsFargoCSV, string(archived))
+	assert.Equal(t, im.ArchiveDir, filepath.Dir(batch.ArchivePath))
+
+	// The same file again is imported, with a warning, and not archived twice
+	report, err = im.ImportFile("WfChecking", download, nil)
+	require.NoError(t, err)
+	require.Len(t, report.Warnings, 1)
+	assert.Contains(t, report.Warnings[0], "already imported into WfChecking")
+
+	again, err := models.GetByID[models.ImportBatch](s.DB, report.BatchID)
+	require.NoError(t, err)
+	assert.NotEqual(t, batch.ID, again.ID)
+	assert.Equal(t, batch.ArchivePath, again.ArchivePath)
+	assert.Equal(t, 0, again.Added)
+	assert.Equal(t, 3, again.Updated)
+
+	// Staged rows still belong to the import that created them
+	raws, err = s.GetRawTransactions()
+	require.NoError(t, err)
+	for _, r := range raws {
+		assert.Equal(t, batch.ID, *r.ImportBatchID)
+	}
+
+	entries, err := os.ReadDir(im.ArchiveDir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestImporter_ImportFile_Duplicates(t *testing.T) {
+	s := setupTestService(t)
+	dir := t.TempDir()
+	im := &Importer{DB: s.DB, ArchiveDir: filepath.Join(dir, "importHistory")}
+
+	// Entered by hand before the download, with the bank's description shortened
+	require.NoError(t, s.DB.Create(&models.Transaction{
+		PostedDate: "2025-11-30", Account: "WfChecking", Amount: 1234, Description: "KROGER",
+		Beneficiary: "Us", Budget: models.PLACEHOLDER_BUDGET,
+	}).Error)
+
+	download := filepath.Join(dir, "Checking1.csv")
+	require.NoError(t, os.WriteFile(download, []byte(wellsFargoCSV), 0644))
+	report, err := im.ImportFile("WfChecking", download, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Duplicates)
+
+	batch, err := models.GetByID[models.ImportBatch](s.DB, report.BatchID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, batch.Duplicates)
+}
+
+func TestImporter_RollbackRestoresStaged(t *testing.T) {
+	s := setupTestService(t)
+	dir := t.TempDir()
+	im := &Importer{DB: s.DB, ArchiveDir: filepath.Join(dir, "importHistory")}
+
+	first := writeFile(t, "Checking1.csv", wellsFargoCSV)
+	_, err := im.ImportFile("WfChecking", first, nil)
+	require.NoError(t, err)
+	raws, err := s.GetRawTransactions()
+	require.NoError(t, err)
+	require.NoError(t, s.DB.Model(&raws[0]).Updates(map[string]any{"budget": models.PLACEHOLDER_BUDGET, "tag": "mine"}).Error)
+
+	// An overlapping download refreshes the staged rows, and is then rolled back
+	second := writeFile(t, "Checking2.csv", wellsFargoCSV)
+	report, err := im.ImportFile("WfChecking", second, nil)
+	require.NoError(t, err)
+	msg, err := s.RollbackImportBatch(report.BatchID)
+	require.NoError(t, err)
+	assert.Contains(t, msg, "removed 0 staged and 0 finalized transactions, restored 3 it changed")
+
+	raws, err = s.GetRawTransactions()
+	require.NoError(t, err)
+	require.Len(t, raws, 3)
+	for _, r := range raws {
+		assert.Equal(t, first, r.SourceFile)
+	}
+	assert.Equal(t, [2]string{models.PLACEHOLDER_BUDGET, "mine"}, [2]string{raws[0].Budget, raws[0].Tag})
+}
+
+func TestImporter_ImportFile_Failure(t *testing.T) {
+	s := setupTestService(t)
+	dir := t.TempDir()
+	im := &Importer{DB: s.DB, ArchiveDir: filepath.Join(dir, "importHistory")}
+
+	download := filepath.Join(dir, "Checking1.csv")
+	require.NoError(t, os.WriteFile(download, []byte(wellsFargoCSV), 0644))
+
+	_, err := im.ImportFile("NoSuchAccount", download, nil)
+	assert.Error(t, err)
+
+	batches, err := s.GetImportBatches()
+	require.NoError(t, err)
+	assert.Empty(t, batches)
+	_, err = os.Stat(im.ArchiveDir)
+	assert.True(t, os.IsNotExist(err), "nothing archived")
+}
+
+func TestImporter_ImportFile_FailureMidFile(t *testing.T) {
+	s := setupTestService(t)
+	oldChunkSize := ProcessChunkSize
+	ProcessChunkSize = 1
+	defer func() { ProcessChunkSize = oldChunkSize }()
+
+	dir := t.TempDir()
+	im := &Importer{DB: s.DB, ArchiveDir: filepath.Join(dir, "importHistory")}
+	download := filepath.Join(dir, "Checking1.csv")
+	require.NoError(t, os.WriteFile(download, []byte(wellsFargoCSV), 0644))
+
+	failOn(t, s.DB, "INSERT", "CHECK # 1234")
+	_, err := im.ImportFile("WfChecking", download, nil)
+	var rowErr *RowError
+	require.ErrorAs(t, err, &rowErr)
+	assert.Equal(t, 3, rowErr.Transaction.Line)
+
+	raws, err := s.GetRawTransactions()
+	require.NoError(t, err)
+	assert.Empty(t, raws)
+	batches, err := s.GetImportBatches()
+	require.NoError(t, err)
+	assert.Empty(t, batches)
+	entries, err := os.ReadDir(im.ArchiveDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries, "archived copy removed")
+}
+
+func TestImporter_Progress(t *testing.T) {
+	s := setupTestService(t)
+	oldChunkSize := ProcessChunkSize
+	ProcessChunkSize = 2
+	defer func() { ProcessChunkSize = oldChunkSize }()
+
+	dir := t.TempDir()
+	im := &Importer{DB: s.DB, ArchiveDir: filepath.Join(dir, "importHistory")}
+	download := filepath.Join(dir, "Checking1.csv")
+	require.NoError(t, os.WriteFile(download, []byte(wellsFargoCSV), 0644))
+
+	var progress []FileProgress
+	_, err := im.ImportFile("WfChecking", download, func(p FileProgress) { progress = append(progress, p) })
+	require.NoError(t, err)
+
+	// A chunk of 2 rows, then the last good row and the short one
+	require.Len(t, progress, 2)
+	assert.Equal(t, 2, progress[0].Rows)
+	assert.Equal(t, 4, progress[1].Rows)
+	assert.Equal(t, 1.0, progress[1].Percent)
+	for _, p := range progress {
+		assert.Equal(t, FileImporting, p.Status)
+		assert.Equal(t, download, p.File)
+	}
+}
@@ -0,0 +1,139 @@
+package transactionImport
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"wailts/models"
+)
+
+var errEmptyAmount = errors.New("empty amount")
+
+// ParseMoney converts a decimal amount as written by a bank into cents, without going through floating point.
+//
+// It accepts currency symbols, thousands separators ("1,234.56", "1.234,56", "1 234,56", "1'234.56"),
+// European decimal commas ("12,34"), and negatives written as "-12.34", "12.34-" or "(12.34)".
+// Fractions of a cent are rounded half away from zero.
+// A lone comma followed by 3 digits is taken as a thousands separator, a lone dot as a decimal point.
+func ParseMoney(s string) (models.Money, error) {
+	orig := s
+
+	// Drop currency symbols and any spacing or apostrophes used for digit grouping
+	s = strings.Map(func(r rune) rune {
+		if unicode.Is(unicode.Sc, r) || unicode.IsSpace(r) || r == '\'' {
+			return -1
+		}
+		return r
+	}, s)
+	if s == "" {
+		return 0, errEmptyAmount
+	}
+
+	negative := false
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		negative = true
+		s = s[1 : len(s)-1]
+	}
+	switch {
+	case strings.HasPrefix(s, "-"):
+		negative = !negative
+		s = s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	case strings.HasSuffix(s, "-"):
+		negative = !negative
+		s = s[:len(s)-1]
+	}
+
+	whole, fraction, err := splitDecimal(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q: %w", orig, err)
+	}
+	if whole == "" && fraction == "" {
+		return 0, fmt.Errorf("invalid amount %q: no digits", orig)
+	}
+	for _, part := range []string{whole, fraction} {
+		for _, r := range part {
+			if r < '0' || r > '9' {
+				return 0, fmt.Errorf("invalid amount %q: unexpected %q", orig, r)
+			}
+		}
+	}
+
+	// Cents are the first two fraction digits, the third decides rounding
+	roundUp := len(fraction) > 2 && fraction[2] >= '5'
+	fraction = (fraction + "00")[:2]
+	if whole == "" {
+		whole = "0"
+	}
+	cents, err := strconv.ParseInt(whole+fraction, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q: %w", orig, err)
+	}
+	if roundUp {
+		cents++
+	}
+	if negative {
+		cents = -cents
+	}
+	return models.Money(cents), nil
+}
+
+// parseOptionalMoney is ParseMoney, but an empty field is zero, as in an empty debit or credit column
+func parseOptionalMoney(s string) (models.Money, error) {
+	m, err := ParseMoney(s)
+	if errors.Is(err, errEmptyAmount) {
+		return 0, nil
+	}
+	return m, err
+}
+
+// splitDecimal separates the whole and fraction digits, removing thousands separators
+func splitDecimal(s string) (whole, fraction string, err error) {
+	lastDot := strings.LastIndex(s, ".")
+	lastComma := strings.LastIndex(s, ",")
+
+	decimal := -1
+	switch {
+	case lastDot >= 0 && lastComma >= 0:
+		// Both present, whichever comes last is the decimal separator
+		decimal = max(lastDot, lastComma)
+	case lastComma >= 0:
+		// "12,34" is a decimal comma, "1,234" and "1,234,567" are grouping
+		if strings.Count(s, ",") == 1 && len(s)-lastComma-1 != 3 {
+			decimal = lastComma
+		}
+	case lastDot >= 0:
+		// "1.234.567" is European grouping, a single dot is a decimal point
+		if strings.Count(s, ".") == 1 {
+			decimal = lastDot
+		}
+	}
+
+	if decimal >= 0 {
+		whole, fraction = s[:decimal], s[decimal+1:]
+	} else {
+		whole = s
+	}
+	if strings.ContainsAny(fraction, ".,") {
+		return "", "", errors.New("misplaced separator")
+	}
+
+	// Whatever separators remain in the whole part must group digits by 3
+	groupSep := ","
+	if decimal >= 0 && s[decimal] == ',' || decimal < 0 && lastDot >= 0 {
+		groupSep = "."
+	}
+	if decimal >= 0 && strings.Contains(whole, s[decimal:decimal+1]) {
+		return "", "", errors.New("misplaced separator")
+	}
+	groups := strings.Split(whole, groupSep)
+	for i, g := range groups {
+		if i == 0 && g == "" && len(groups) > 1 || i > 0 && len(g) != 3 {
+			return "", "", errors.New("misplaced separator")
+		}
+	}
+	return strings.Join(groups, ""), fraction, nil
+}
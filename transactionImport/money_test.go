@@ -0,0 +1,80 @@
+package transactionImport
+
+import (
+	"testing"
+	"wailts/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected models.Money
+	}{
+		// Values that float64 can't represent exactly
+		{"19.99", 1999},
+		{"0.29", 29},
+		{"1.15", 115},
+		{"4.35", 435},
+		{"-19.99", -1999},
+		{"1234567.89", 123456789},
+
+		// Missing or partial fractions
+		{"12", 1200},
+		{"12.5", 1250},
+		{".5", 50},
+		{"0.07", 7},
+
+		// Fractions of a cent round half away from zero
+		{"1.005", 101},
+		{"1.004", 100},
+		{"19.999", 2000},
+		{"-0.005", -1},
+
+		// Signs
+		{"+12.34", 1234},
+		{"12.34-", -1234},
+		{"(12.34)", -1234},
+		{"($1,234.56)", -123456},
+		{"-$12.34", -1234},
+		{"$-12.34", -1234},
+
+		// Currency symbols, grouping and whitespace
+		{"$1,234.56", 123456},
+		{" 1,234,567.00 ", 123456700},
+		{"1,234", 123400},
+		{"€12,34", 1234},
+		{"1.234,56 €", 123456},
+		{"1.234.567", 123456700},
+		{"1 234,56", 123456},
+		{"1'234.56", 123456},
+		{"£0.99", 99},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			got, err := ParseMoney(tc.input)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, got)
+		})
+	}
+}
+
+func TestParseMoney_Invalid(t *testing.T) {
+	for _, input := range []string{"", "  ", "$", "abc", "12.34.56,7", "1,2,3.4.5", "12x", "--5", "."} {
+		t.Run(input, func(t *testing.T) {
+			_, err := ParseMoney(input)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestParseOptionalMoney(t *testing.T) {
+	m, err := parseOptionalMoney("")
+	assert.NoError(t, err)
+	assert.Equal(t, models.Money(0), m)
+
+	_, err = parseOptionalMoney("n/a")
+	assert.Error(t, err)
+}
@@ -0,0 +1,209 @@
+package transactionImport
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"iter"
+	"regexp"
+	"strings"
+	"wailts/models"
+)
+
+// OFXParser reads OFX statement downloads, both 1.x (SGML, where elements
+// needn't be closed) and 2.x (XML).  QFX files are OFX with extra Quicken elements.
+type OFXParser struct {
+	Beneficiary string // Every transaction's, see beneficiaryOrDefault
+	Currency    string // Currency of the account, used if the statement has no CURDEF
+	Number      string // The account's number; statements the file has for other accounts are skipped
+}
+
+func (p *OFXParser) Rows(reader io.Reader) iter.Seq2[ParsedRow, error] {
+	return func(yield func(ParsedRow, error) bool) {
+		s := newOFXScanner(reader)
+
+		// Skip the SGML header block or XML prolog
+		for !(s.scan() && s.name == "OFX" && !s.closing) {
+			if s.err != nil {
+				if s.err == io.EOF {
+					s.err = errors.New("not an OFX file: no <OFX> element")
+				}
+				yield(ParsedRow{}, s.err)
+				return
+			}
+		}
+
+		var fields map[string]string // elements of the current STMTTRN, nil when outside one
+		var raw strings.Builder      // text of the current STMTTRN
+		trnLine := 0
+		currency := p.Currency
+		skipping := false // In a statement for another account
+		otherAccounts := map[string]bool{}
+		found := false
+		for s.scan() {
+			switch {
+			case (s.name == "STMTRS" || s.name == "CCSTMTRS") && !s.closing:
+				skipping = false
+			case s.name == "ACCTID" && !s.closing && fields == nil:
+				// The statement's account, which comes before its transactions
+				acctID := strings.TrimSpace(s.text)
+				if p.Number != "" && !accountNumberMatches(acctID, p.Number) {
+					skipping = true
+					otherAccounts[acctID] = true
+				}
+			case skipping:
+			case s.name == "CURDEF" && !s.closing && fields == nil:
+				// The statement's currency, which comes before its transactions
+				currency = strings.ToUpper(strings.TrimSpace(s.text))
+			case s.name == "STMTTRN" && !s.closing:
+				fields = map[string]string{}
+				trnLine = s.line
+				raw.Reset()
+				raw.WriteString(s.tag)
+				raw.WriteString(s.text)
+			case s.name == "STMTTRN" && s.closing:
+				if fields == nil {
+					continue
+				}
+				raw.WriteString(s.tag)
+				found = true
+				pt, err := p.transaction(fields)
+				pt.Line = trnLine
+				pt.Currency = currency
+				fields = nil
+				row := ParsedRow{Transaction: pt}
+				if err != nil {
+					row = rejectRow(trnLine, raw.String(), err.Error())
+				}
+				if !yield(row, nil) {
+					return
+				}
+			case fields != nil:
+				raw.WriteString(s.tag)
+				raw.WriteString(s.text)
+				if !s.closing {
+					fields[s.name] = html.UnescapeString(strings.TrimSpace(s.text))
+				}
+			}
+		}
+		if s.err != io.EOF {
+			yield(ParsedRow{}, s.err)
+			return
+		}
+		if !found && len(otherAccounts) > 0 {
+			yield(ParsedRow{}, noTransactionsFor(p.Number, otherAccounts))
+		}
+	}
+}
+
+// ofxScanner splits OFX into tags, each with the text that follows it up to the next tag
+type ofxScanner struct {
+	r        *bufio.Reader
+	nextLine int // Line of the next byte to be read
+
+	// The current tag
+	tag     string // As written, e.g. "</NAME>"
+	name    string // Upper case element name, e.g. "NAME"
+	closing bool
+	text    string // Text after the tag, up to the next one
+	line    int    // 1-based line the tag is on
+	err     error  // io.EOF at the end of the file
+}
+
+func newOFXScanner(r io.Reader) *ofxScanner {
+	s := &ofxScanner{r: bufio.NewReader(r), nextLine: 1}
+	_, s.err = s.readUntil('<')
+	return s
+}
+
+// ofxNamePattern is what can be an element name, anything else in <> (e.g. an XML prolog) is skipped
+var ofxNamePattern = regexp.MustCompile(`^/?[A-Za-z0-9.]+$`)
+
+// scan advances to the next tag, reporting whether there is one.
+// Between calls the reader is positioned just after a '<'.
+func (s *ofxScanner) scan() bool {
+	for s.err == nil {
+		line := s.nextLine
+		inner, err := s.readUntil('>')
+		if err != nil {
+			s.err = err
+			return false
+		}
+		// At the end of the file, the text runs to the end and the next scan stops
+		text, err := s.readUntil('<')
+		s.err = err
+
+		if !ofxNamePattern.MatchString(inner) {
+			continue
+		}
+		s.tag = "<" + inner + ">"
+		s.closing = strings.HasPrefix(inner, "/")
+		s.name = strings.ToUpper(strings.TrimPrefix(inner, "/"))
+		s.text = text
+		s.line = line
+		return true
+	}
+	return false
+}
+
+// readUntil returns the text up to the delimiter, consuming but not including it
+func (s *ofxScanner) readUntil(delim byte) (string, error) {
+	text, err := s.r.ReadString(delim)
+	s.nextLine += strings.Count(text, "\n")
+	return strings.TrimSuffix(text, string(delim)), err
+}
+
+// transaction maps the elements of one STMTTRN to a ParsedTransaction
+func (p *OFXParser) transaction(fields map[string]string) (ParsedTransaction, error) {
+	postedDate, err := parseOFXDate(fields["DTPOSTED"])
+	if err != nil {
+		return ParsedTransaction{}, err
+	}
+
+	// DTUSER is when the user made the transaction, if the bank gives it
+	var transactionDate models.Date
+	if fields["DTUSER"] != "" {
+		if transactionDate, err = parseOFXDate(fields["DTUSER"]); err != nil {
+			return ParsedTransaction{}, fmt.Errorf("DTUSER: %w", err)
+		}
+	}
+
+	// MEMO is the description if there's no NAME
+	description, memo := fields["NAME"], fields["MEMO"]
+	if description == "" {
+		description, memo = memo, ""
+	}
+
+	checkNumber := fields["CHECKNUM"]
+	if checkNumber == "" {
+		checkNumber = checkNumberIn(description)
+	}
+
+	// OFX amounts are negative for money leaving the account, we want expenses positive
+	amount, err := ParseMoney(fields["TRNAMT"])
+	if err != nil {
+		return ParsedTransaction{}, err
+	}
+
+	return ParsedTransaction{
+		PostedDate:      postedDate,
+		TransactionDate: transactionDate,
+		Amount:          -amount,
+		Description:     description,
+		Beneficiary:     beneficiaryOrDefault(p.Beneficiary),
+		ExternalID:      fields["FITID"],
+		CheckNumber:     checkNumber,
+		Memo:            memo,
+		SourceRow:       encodeSourceRow(fields), // Keyed by element name
+	}, nil
+}
+
+// parseOFXDate reads the date part of an OFX datetime, e.g. "20251231120000.000[-5:EST]"
+func parseOFXDate(s string) (models.Date, error) {
+	if len(s) < 8 {
+		return "", fmt.Errorf("unable to parse date: %s", s)
+	}
+	return parseDate(s[:8], []string{"20060102"})
+}
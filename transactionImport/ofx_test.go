@@ -0,0 +1,149 @@
+package transactionImport
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const ofxSGML = `OFXHEADER:100
+DATA:OFXSGML
+VERSION:102
+SECURITY:NONE
+ENCODING:USASCII
+
+<OFX>
+<SIGNONMSGSRSV1><SONRS><STATUS><CODE>0<SEVERITY>INFO</STATUS><DTSERVER>20251231</SONRS></SIGNONMSGSRSV1>
+<BANKMSGSRSV1><STMTTRNRS><STMTRS>
+<CURDEF>USD
+<BANKTRANLIST>
+<DTSTART>20251201<DTEND>20251231
+<STMTTRN>
+<TRNTYPE>DEBIT
+<DTPOSTED>20251202120000.000[-5:EST]
+<TRNAMT>-4.75
+<FITID>2025120201
+<NAME>COFFEE SHOP
+<MEMO>POS PURCHASE
+</STMTTRN>
+<STMTTRN>
+<TRNTYPE>CREDIT
+<DTPOSTED>20251215
+<TRNAMT>1500.00
+<FITID>2025121501
+<MEMO>PAYROLL &amp; BONUS
+</STMTTRN>
+</BANKTRANLIST>
+</STMTRS></STMTTRNRS></BANKMSGSRSV1>
+</OFX>
+`
+
+const ofxXML = `<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<?OFX OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>
+<OFX>
+  <CREDITCARDMSGSRSV1>
+    <CCSTMTTRNRS>
+      <CCSTMTRS>
+        <CURDEF>EUR</CURDEF>
+        <BANKTRANLIST>
+          <STMTTRN>
+            <TRNTYPE>DEBIT</TRNTYPE>
+            <DTPOSTED>20251203</DTPOSTED>
+            <DTUSER>20251130</DTUSER>
+            <TRNAMT>-19.99</TRNAMT>
+            <FITID>AB-123</FITID>
+            <NAME>BOOKSTORE</NAME>
+          </STMTTRN>
+        </BANKTRANLIST>
+      </CCSTMTRS>
+    </CCSTMTTRNRS>
+  </CREDITCARDMSGSRSV1>
+</OFX>
+`
+
+func TestOFXParser(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []ParsedTransaction
+	}{
+		{
+			name:  "SGML",
+			input: ofxSGML,
+			expected: []ParsedTransaction{
+				{PostedDate: "2025-12-02", Amount: 475, Currency: "USD", Description: "COFFEE SHOP", Beneficiary: "Us", ExternalID: "2025120201", Memo: "POS PURCHASE", Line: 13},
+				{PostedDate: "2025-12-15", Amount: -150000, Currency: "USD", Description: "PAYROLL & BONUS", Beneficiary: "Us", ExternalID: "2025121501", Line: 21},
+			},
+		},
+		{
+			name:  "XML",
+			input: ofxXML,
+			expected: []ParsedTransaction{
+				{PostedDate: "2025-12-03", TransactionDate: "2025-11-30", Amount: 1999, Currency: "EUR", Description: "BOOKSTORE", Beneficiary: "Us", ExternalID: "AB-123", Line: 9},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &OFXParser{Beneficiary: "Us"}
+			got, err := ParseAll(p, strings.NewReader(tc.input))
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, withoutSourceRows(got.Accepted))
+			assert.Empty(t, got.Rejected)
+		})
+	}
+}
+
+func TestOFXParser_Number(t *testing.T) {
+	// Statements for two accounts
+	ofx := strings.Replace(ofxSGML, "<CURDEF>USD\n", "<CURDEF>USD\n<BANKACCTFROM><ACCTID>XXXXXX1234</BANKACCTFROM>\n", 1)
+	ofx = strings.Replace(ofx, "</STMTTRNRS>", "</STMTTRNRS><STMTTRNRS><STMTRS><BANKACCTFROM><ACCTID>XXXXXX5678</BANKACCTFROM>"+
+		"<BANKTRANLIST><STMTTRN><DTPOSTED>20251220<TRNAMT>-1.00<NAME>OTHER</STMTTRN></BANKTRANLIST></STMTRS></STMTTRNRS>", 1)
+
+	got, err := ParseAll(&OFXParser{Number: "5678"}, strings.NewReader(ofx))
+	require.NoError(t, err)
+	require.Len(t, got.Accepted, 1)
+	assert.Equal(t, "OTHER", got.Accepted[0].Description)
+
+	got, err = ParseAll(&OFXParser{}, strings.NewReader(ofx))
+	require.NoError(t, err)
+	assert.Len(t, got.Accepted, 3, "no number, no skipping")
+
+	_, err = ParseAll(&OFXParser{Number: "9999"}, strings.NewReader(ofx))
+	assert.ErrorContains(t, err, "no transactions for account 9999, the file has accounts XXXXXX1234, XXXXXX5678")
+}
+
+func TestOFXParser_BadTransaction(t *testing.T) {
+	input := "<OFX>\n<STMTTRN>\n<DTPOSTED>20251202\n<TRNAMT>-1.00\n</STMTTRN>\n" +
+		"<STMTTRN>\n<DTPOSTED>20251203\n<TRNAMT>one dollar\n</STMTTRN>\n</OFX>\n"
+
+	p := &OFXParser{}
+	got, err := ParseAll(p, strings.NewReader(input))
+	require.NoError(t, err)
+	require.Len(t, got.Accepted, 1)
+	assert.JSONEq(t, `{"DTPOSTED":"20251202","TRNAMT":"-1.00"}`, got.Accepted[0].SourceRow)
+	assert.Equal(t, []RejectedRow{{
+		Line:   6,
+		Raw:    "<STMTTRN>\n<DTPOSTED>20251203\n<TRNAMT>one dollar\n</STMTTRN>",
+		Reason: `invalid amount "one dollar": unexpected 'o'`,
+	}}, got.Rejected)
+}
+
+func TestOFXParser_NotOFX(t *testing.T) {
+	p := &OFXParser{}
+	_, err := ParseAll(p, strings.NewReader("Date,Amount\n2025-01-01,1.00\n"))
+	assert.ErrorContains(t, err, "not an OFX file")
+}
+
+func TestGetParser_OFXByExtension(t *testing.T) {
+	s := setupTestService(t)
+
+	for _, name := range []string{"statement.ofx", "STATEMENT.QFX"} {
+		parser, err := GetParser(s.DB, "WfChecking", name)
+		require.NoError(t, err)
+		assert.IsType(t, &OFXParser{}, parser, name)
+	}
+}
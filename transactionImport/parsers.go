@@ -2,190 +2,428 @@ package transactionImport
 
 import (
 	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"iter"
+	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
 	"wailts/models"
+
+	"gorm.io/gorm"
 )
 
 // ParsedTransaction represents a normalized transaction from a CSV file
 type ParsedTransaction struct {
-	PostedDate  models.Date
-	Amount      models.Money
-	Description string
-	Beneficiary string
-	RawHint     string
+	PostedDate      models.Date
+	TransactionDate models.Date // When the purchase was made, empty if the format doesn't say
+	Amount          models.Money
+	Currency        string // ISO 4217 code of Amount, empty for the home currency
+	Description     string
+	Beneficiary     string
+	RawHint         string
+	ExternalID      string // Bank-supplied transaction ID (e.g. OFX FITID), if the format has one
+	CheckNumber     string
+	Memo            string
+	Line            int    // 1-based line in the file where the row starts
+	SourceRow       string // The whole row as JSON, including the fields the format doesn't use
+	SourceFile      string // Set by the importer, parsers don't know the file's name
+}
+
+// RejectedRow is a row of an import file that didn't become a transaction, and why
+type RejectedRow struct {
+	Line   int    // 1-based line number in the file
+	Raw    string // Text of the row, as near as the parser can reconstruct it
+	Reason string
+}
+
+// ParseResult lists what a parser made of every row in a file
+type ParseResult struct {
+	Accepted []ParsedTransaction
+	Rejected []RejectedRow
+}
+
+// ParsedRow is one row of a file: a transaction, or why the row was rejected
+type ParsedRow struct {
+	Transaction ParsedTransaction
+	Rejected    *RejectedRow // Set if the row isn't a transaction
+}
+
+func rejectRow(line int, raw string, reason string) ParsedRow {
+	return ParsedRow{Rejected: &RejectedRow{Line: line, Raw: raw, Reason: reason}}
 }
 
-// Parser is the interface that all CSV parsers must implement
+// Parser is the interface that all import parsers must implement.
+// Rows yields the rows of a file as they are read, so the whole file is never in memory.
+// Problems with individual rows are yielded as rejected rows;
+// an error means the rest of the file couldn't be read, and ends the sequence.
 type Parser interface {
-	Parse(reader io.Reader) ([]ParsedTransaction, error)
+	Rows(reader io.Reader) iter.Seq2[ParsedRow, error]
 }
 
-// GetParser returns the appropriate parser for a given account name
-// Using Account Name as the format identifier as per plan
-func GetParser(accountName string) (Parser, error) {
-	switch accountName {
-	case "CapitalOne":
-		return &CapitalOneParser{}, nil
-	case "WfChecking":
-		return &WFCheckingParser{}, nil
-	case "WfVisa":
-		return &WFVisaParser{}, nil
-	default:
-		return nil, fmt.Errorf("no parser found for account: %s", accountName)
+// ParseAll collects every row of a file, for when it's known to be small
+func ParseAll(p Parser, reader io.Reader) (*ParseResult, error) {
+	result := &ParseResult{}
+	for row, err := range p.Rows(reader) {
+		if err != nil {
+			return nil, err
+		}
+		if row.Rejected != nil {
+			result.Rejected = append(result.Rejected, *row.Rejected)
+		} else {
+			result.Accepted = append(result.Accepted, row.Transaction)
+		}
 	}
+	return result, nil
 }
 
-// --- Parsers ---
+// GetParser returns the appropriate parser for a file downloaded from a given account.
+// OFX, QFX, QIF and PDF files are recognized by extension; anything else is CSV.
+// CSV and PDF are read using the account's ImportFormat.  An account without
+// one (or not in the DB at all) uses the format with the same name as the account.
+func GetParser(db *gorm.DB, accountName string, fileName string) (Parser, error) {
+	var account models.Account
+	if err := db.Where("name = ?", accountName).Limit(1).Find(&account).Error; err != nil {
+		return nil, err
+	}
 
-// CapitalOneParser matches "CapitalOne" format
-type CapitalOneParser struct{}
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".ofx", ".qfx":
+		return &OFXParser{Beneficiary: account.Beneficiary, Currency: account.Currency, Number: account.Number}, nil
+	case ".qif":
+		// QIF dates are month first, unless the account's format has layouts for them
+		p := &QIFParser{Account: accountName, Number: account.Number, Beneficiary: account.Beneficiary, Currency: account.Currency}
+		if account.ImportFormat != "" {
+			if format, err := LookupFormat(db, account.ImportFormat); err == nil && strings.TrimSpace(format.DateLayouts) != "" {
+				p.DateLayouts = dateLayouts(format)
+			}
+		}
+		return p, nil
+	}
 
-func (p *CapitalOneParser) Parse(reader io.Reader) ([]ParsedTransaction, error) {
-	r := csv.NewReader(reader)
-	records, err := r.ReadAll()
+	formatName := accountName
+	if account.ImportFormat != "" {
+		formatName = account.ImportFormat
+	}
+
+	format, err := LookupFormat(db, formatName)
 	if err != nil {
-		fmt.Printf("[Parser] CapitalOne CSV read error: %v\n", err)
+		return nil, fmt.Errorf("no parser found for account %s: %w", accountName, err)
+	}
+	if strings.EqualFold(filepath.Ext(fileName), ".pdf") {
+		if strings.TrimSpace(format.LineRegex) == "" {
+			return nil, fmt.Errorf("no parser found for account %s: import format %s doesn't read PDF statements", accountName, format.Name)
+		}
+		return &PDFParser{Format: *format, Beneficiary: account.Beneficiary, Currency: account.Currency}, nil
+	}
+	var cards []models.CardBeneficiary
+	if err := db.Where("account = ?", accountName).Find(&cards).Error; err != nil {
 		return nil, err
 	}
-	fmt.Printf("[Parser] CapitalOne read %d records (including header)\n", len(records))
+	return &CSVParser{Format: *format, Cards: cards, Beneficiary: account.Beneficiary, Currency: account.Currency}, nil
+}
 
-	var results []ParsedTransaction
+// --- Parsers ---
 
-	// Header expected: Transaction Date, Posted Date, Card No., Description, Category, Debit, Credit
-	// We skip the first row
-	if len(records) > 0 {
-		records = records[1:]
-	}
+// CSVParser reads any CSV download described by an ImportFormat
+type CSVParser struct {
+	Format      models.ImportFormat
+	Cards       []models.CardBeneficiary // Who holds each card, if the format has a card column
+	Beneficiary string                   // The account's, for rows neither a card nor the format gives one, see beneficiaryOrDefault
+	Currency    string                   // Currency of the account, CSV downloads don't say
+}
 
-	for i, row := range records {
-		if len(row) < 7 {
-			fmt.Printf("[Parser] Skipping short record at row %d: %v\n", i+1, row)
-			continue
-		}
+// csvColumns holds the resolved column indexes of a format, -1 where the format doesn't use the column
+type csvColumns struct {
+	postedDate, transactionDate, description, rawHint, amount, debit, credit, externalID, card, checkNumber, memo int
+}
 
-		// Posted Date (Col 1)
-		postedDate, err := parseDate(row[1])
-		if err != nil {
-			continue
+// Rows reads the file a record at a time
+func (p *CSVParser) Rows(reader io.Reader) iter.Seq2[ParsedRow, error] {
+	return func(yield func(ParsedRow, error) bool) {
+		f := &p.Format
+		r := csv.NewReader(reader)
+		r.FieldsPerRecord = -1 // Allow variable fields, short rows are rejected below
+
+		var header []string
+		var cols *csvColumns
+		layouts := dateLayouts(f)
+
+		line := 0 // Of the last record read
+		for recordNum := 1; ; recordNum++ {
+			row, err := r.Read()
+			if err == io.EOF {
+				return
+			}
+			var csvErr *csv.ParseError
+			if errors.As(err, &csvErr) {
+				// Malformed quoting and such, the reader carries on with the next line
+				if !yield(rejectRow(csvErr.StartLine, "", csvErr.Err.Error()), nil) {
+					return
+				}
+				continue
+			}
+			if err != nil {
+				// The rest of the file can't be read, which the report lists as a rejected row
+				yield(rejectRow(line+1, "", "unable to read the rest of the file: "+err.Error()), nil)
+				return
+			}
+			line, _ = r.FieldPos(0)
+
+			if recordNum <= f.HeaderRows {
+				header = row
+				continue
+			}
+			if cols == nil {
+				if cols, err = resolveColumns(f, header); err != nil {
+					yield(ParsedRow{}, err)
+					return
+				}
+			}
+
+			if !yield(p.parseRow(cols, layouts, header, line, row), nil) {
+				return
+			}
 		}
+	}
+}
+
+// parseRow turns one CSV record into a transaction, or rejects it
+func (p *CSVParser) parseRow(cols *csvColumns, layouts []string, header []string, line int, row []string) ParsedRow {
+	f := &p.Format
+	if len(row) < f.MinColumns {
+		return rejectRow(line, csvText(row), fmt.Sprintf("expected at least %d fields, found %d", f.MinColumns, len(row)))
+	}
+
+	postedDate, err := parseDate(field(row, cols.postedDate), layouts)
+	if err != nil {
+		return rejectRow(line, csvText(row), err.Error())
+	}
 
-		// Card No. (Col 2) -> Beneficiary
-		cardNo := row[2]
-		beneficiary := "Us"
-		if strings.HasSuffix(cardNo, "3028") {
-			beneficiary = "Bob"
-		} else if strings.HasSuffix(cardNo, "6539") {
-			beneficiary = "Jessie"
+	var transactionDate models.Date
+	if s := field(row, cols.transactionDate); strings.TrimSpace(s) != "" {
+		if transactionDate, err = parseDate(s, layouts); err != nil {
+			return rejectRow(line, csvText(row), "transaction date: "+err.Error())
 		}
+	}
 
-		// Description (Col 3)
-		description := row[3]
+	amount, err := csvAmount(f, cols, row)
+	if err != nil {
+		return rejectRow(line, csvText(row), err.Error())
+	}
 
-		// Category (Col 4) -> RawHint
-		rawHint := row[4]
+	description := field(row, cols.description)
+	checkNumber := strings.TrimSpace(field(row, cols.checkNumber))
+	if checkNumber == "" {
+		checkNumber = checkNumberIn(description)
+	}
 
-		// Debit (Col 5), Credit (Col 6) -> Amount
-		// Formula: (Debit*100) - (Credit*100)
-		debitVal := parseAmountVal(row[5])
-		creditVal := parseAmountVal(row[6])
-		amount := models.Money(int64((debitVal * 100) - (creditVal * 100)))
+	return ParsedRow{Transaction: ParsedTransaction{
+		PostedDate:      postedDate,
+		TransactionDate: transactionDate,
+		Amount:          amount,
+		Currency:        p.Currency,
+		Description:     description,
+		Beneficiary:     beneficiaryOrDefault(cardBeneficiary(p.Cards, field(row, cols.card)), f.DefaultBeneficiary, p.Beneficiary),
+		RawHint:         field(row, cols.rawHint),
+		ExternalID:      strings.TrimSpace(field(row, cols.externalID)),
+		CheckNumber:     checkNumber,
+		Memo:            strings.TrimSpace(field(row, cols.memo)),
+		Line:            line,
+		SourceRow:       sourceRow(header, row),
+	}}
+}
 
-		results = append(results, ParsedTransaction{
-			PostedDate:  postedDate,
-			Amount:      amount,
-			Description: description,
-			Beneficiary: beneficiary,
-			RawHint:     rawHint,
-		})
+// csvAmount reads the amount of a row, either from a single amount column or as debit - credit
+func csvAmount(f *models.ImportFormat, cols *csvColumns, row []string) (models.Money, error) {
+	var amount models.Money
+	if cols.amount >= 0 {
+		a, err := ParseMoney(field(row, cols.amount))
+		if err != nil {
+			return 0, err
+		}
+		amount = a
+	} else {
+		debit, err := parseOptionalMoney(field(row, cols.debit))
+		if err != nil {
+			return 0, err
+		}
+		credit, err := parseOptionalMoney(field(row, cols.credit))
+		if err != nil {
+			return 0, err
+		}
+		amount = debit - credit
 	}
-	return results, nil
+	if f.NegateAmount {
+		amount = -amount
+	}
+	return amount, nil
 }
 
-// WFCheckingParser matches "WfChecking" format
-type WFCheckingParser struct{}
+// --- Helpers ---
 
-func (p *WFCheckingParser) Parse(reader io.Reader) ([]ParsedTransaction, error) {
-	return parseWellsFargo(reader)
+func resolveColumns(f *models.ImportFormat, header []string) (*csvColumns, error) {
+	cols := &csvColumns{}
+	refs := []struct {
+		ref string
+		idx *int
+	}{
+		{f.PostedDateColumn, &cols.postedDate},
+		{f.TransactionDateColumn, &cols.transactionDate},
+		{f.DescriptionColumn, &cols.description},
+		{f.RawHintColumn, &cols.rawHint},
+		{f.AmountColumn, &cols.amount},
+		{f.DebitColumn, &cols.debit},
+		{f.CreditColumn, &cols.credit},
+		{f.ExternalIDColumn, &cols.externalID},
+		{f.CardColumn, &cols.card},
+		{f.CheckNumberColumn, &cols.checkNumber},
+		{f.MemoColumn, &cols.memo},
+	}
+	for _, r := range refs {
+		idx, err := resolveColumn(r.ref, header)
+		if err != nil {
+			return nil, fmt.Errorf("import format %s: %w", f.Name, err)
+		}
+		*r.idx = idx
+	}
+	if cols.postedDate < 0 {
+		return nil, fmt.Errorf("import format %s: no posted date column", f.Name)
+	}
+	if cols.amount < 0 && cols.debit < 0 && cols.credit < 0 {
+		return nil, fmt.Errorf("import format %s: no amount, debit or credit column", f.Name)
+	}
+	return cols, nil
 }
 
-// WFVisaParser matches "WfVisa" format
-type WFVisaParser struct{}
+// resolveColumn turns a column reference into an index, -1 if the reference is empty
+func resolveColumn(ref string, header []string) (int, error) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return -1, nil
+	}
+	if idx, err := strconv.Atoi(ref); err == nil {
+		if idx < 0 {
+			return -1, fmt.Errorf("invalid column index %d", idx)
+		}
+		return idx, nil
+	}
+	for i, name := range header {
+		if strings.EqualFold(strings.TrimSpace(name), ref) {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("column %q not found in header", ref)
+}
 
-func (p *WFVisaParser) Parse(reader io.Reader) ([]ParsedTransaction, error) {
-	return parseWellsFargo(reader)
+// csvText re-encodes a row as a line of CSV
+func csvText(row []string) string {
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+	w.Write(row)
+	w.Flush()
+	return strings.TrimRight(b.String(), "\n")
 }
 
-// Wrapper for WF logic since Checking and Visa share identical structure and logic in the current rule
-func parseWellsFargo(reader io.Reader) ([]ParsedTransaction, error) {
-	r := csv.NewReader(reader)
-	r.FieldsPerRecord = -1 // Allow variable fields
-	records, err := r.ReadAll()
-	if err != nil {
-		return nil, err
+// sourceRow encodes a CSV record as a JSON object keyed by column header.
+// Columns without a header, or repeating an earlier one, are keyed by index.
+func sourceRow(header []string, row []string) string {
+	fields := make(map[string]string, len(row))
+	for i, v := range row {
+		key := strconv.Itoa(i)
+		if name := strings.TrimSpace(field(header, i)); name != "" {
+			if _, taken := fields[name]; !taken {
+				key = name
+			}
+		}
+		fields[key] = v
 	}
+	return encodeSourceRow(fields)
+}
 
-	var results []ParsedTransaction
+// encodeSourceRow encodes the fields of a row as the JSON object kept as its SourceRow
+func encodeSourceRow(fields map[string]string) string {
+	b, _ := json.Marshal(fields) // A map of strings always encodes
+	return string(b)
+}
 
-	// No Header
-	for _, row := range records {
-		if len(row) < 5 {
-			continue
-		}
+// defaultBeneficiary is who transactions belong to when neither the file nor
+// the account says who made them
+const defaultBeneficiary = "Us"
 
-		// Col 0: Posted Date
-		postedDate, err := parseDate(row[0])
-		if err != nil {
-			continue
+// beneficiaryOrDefault returns the first of beneficiaries that is set, e.g.
+// a card's holder, then the format's default, then the account's, or
+// defaultBeneficiary if none is.  OFX and QIF files don't say who made a
+// purchase, so only the account's applies to them.
+func beneficiaryOrDefault(beneficiaries ...string) string {
+	for _, b := range beneficiaries {
+		if b != "" {
+			return b
 		}
+	}
+	return defaultBeneficiary
+}
 
-		// Col 1: Amount
-		// Formula: -1 * value * 100
-		val := parseAmountVal(row[1])
-		amount := models.Money(int64(-1 * val * 100))
+func field(row []string, idx int) string {
+	if idx < 0 || idx >= len(row) {
+		return ""
+	}
+	return row[idx]
+}
 
-		// Col 2, 3 ignored
+// checkPattern finds the number in descriptions of checks like "CHECK # 1234" or "Check 1234"
+var checkPattern = regexp.MustCompile(`(?i)^\s*CHECK\s*(?:#|NO\.?)?\s*(\d+)\b`)
 
-		// Col 4: Description
-		// Note usage of row[4] matches 5th column 0-indexed?
-		// "field 5: maps to .Description" -> index 4.
-		// "field 1: maps to .PostedDate" -> index 0.
-		description := row[4]
+// checkNumberIn returns the check number in a description, "" if it isn't a check
+func checkNumberIn(description string) string {
+	if m := checkPattern.FindStringSubmatch(description); m != nil {
+		return m[1]
+	}
+	return ""
+}
 
-		results = append(results, ParsedTransaction{
-			PostedDate:  postedDate,
-			Amount:      amount,
-			Description: description,
-			Beneficiary: "Us",
-			RawHint:     "",
-		})
+// cardBeneficiary returns the holder of a card number, "" if no card matches.
+// The longest matching suffix wins, so "13028" can be told apart from "3028".
+func cardBeneficiary(cards []models.CardBeneficiary, cardNo string) string {
+	cardNo = strings.TrimSpace(cardNo)
+	if cardNo == "" {
+		return ""
 	}
-	return results, nil
+	beneficiary, longest := "", 0
+	for _, c := range cards {
+		suffix := strings.TrimSpace(c.CardSuffix)
+		if suffix != "" && len(suffix) > longest && strings.HasSuffix(cardNo, suffix) {
+			beneficiary, longest = c.Beneficiary, len(suffix)
+		}
+	}
+	return beneficiary
 }
 
-// --- Helpers ---
+var defaultDateLayouts = []string{"2006-01-02", "01/02/2006"}
 
-func parseDate(s string) (models.Date, error) {
-	layouts := []string{"2006-01-02", "01/02/2006"}
+func dateLayouts(f *models.ImportFormat) []string {
+	if strings.TrimSpace(f.DateLayouts) == "" {
+		return defaultDateLayouts
+	}
+	var layouts []string
+	for _, l := range strings.Split(f.DateLayouts, ",") {
+		if l = strings.TrimSpace(l); l != "" {
+			layouts = append(layouts, l)
+		}
+	}
+	return layouts
+}
+
+func parseDate(s string, layouts []string) (models.Date, error) {
 	for _, layout := range layouts {
-		t, err := time.Parse(layout, s)
+		t, err := time.Parse(layout, strings.TrimSpace(s))
 		if err == nil {
 			return models.Date(t.Format("2006-01-02")), nil
 		}
 	}
 	return "", fmt.Errorf("unable to parse date: %s", s)
 }
-
-func parseAmountVal(s string) float64 {
-	if s == "" {
-		return 0
-	}
-	s = strings.ReplaceAll(s, "$", "")
-	s = strings.ReplaceAll(s, ",", "")
-	s = strings.ReplaceAll(s, " ", "") // Shouldnt happen but safe
-	val, _ := strconv.ParseFloat(s, 64)
-	return val
-}
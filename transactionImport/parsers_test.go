@@ -0,0 +1,289 @@
+package transactionImport
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"wailts/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupTestService(t *testing.T) *models.Service {
+	t.Helper()
+	s, err := models.NewService(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	require.NoError(t, s.Clean()) // seed accounts and beneficiaries
+	return s
+}
+
+const capitalOneCSV = `Transaction Date,Posted Date,Card No.,Description,Category,Debit,Credit
+2025-12-20,2025-12-22,3028,KROGER #123,Groceries,19.99,
+2025-12-21,2025-12-22,6539,AMAZON.COM,Merchandise,"1,200.00",
+2025-12-23,2025-12-24,9999,PAYMENT THANK YOU,Payment/Credit,,500.00
+short,row
+2025-12-23,not a date,9999,BAD DATE,Other,1.00,
+`
+
+const wellsFargoCSV = `"12/01/2025","-12.34","*","","PURCHASE AUTHORIZED ON 11/30 KROGER"
+"12/02/2025","2500.00","*","","PAYROLL DEPOSIT"
+"12/03/2025","-100.00","*","1234","CHECK # 1234"
+"12/04/2025","-1.00"
+`
+
+func TestBuiltinFormats(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		input    string
+		expected []ParsedTransaction
+		rejected []RejectedRow
+	}{
+		{
+			name:   "CapitalOne",
+			format: "CapitalOne",
+			input:  capitalOneCSV,
+			expected: []ParsedTransaction{
+				{PostedDate: "2025-12-22", TransactionDate: "2025-12-20", Amount: 1999, Description: "KROGER #123", Beneficiary: "Bob", RawHint: "Groceries", Line: 2},
+				{PostedDate: "2025-12-22", TransactionDate: "2025-12-21", Amount: 120000, Description: "AMAZON.COM", Beneficiary: "Jessie", RawHint: "Merchandise", Line: 3},
+				{PostedDate: "2025-12-24", TransactionDate: "2025-12-23", Amount: -50000, Description: "PAYMENT THANK YOU", Beneficiary: "Us", RawHint: "Payment/Credit", Line: 4},
+			},
+			rejected: []RejectedRow{
+				{Line: 5, Raw: "short,row", Reason: "expected at least 7 fields, found 2"},
+				{Line: 6, Raw: "2025-12-23,not a date,9999,BAD DATE,Other,1.00,", Reason: "unable to parse date: not a date"},
+			},
+		},
+		{
+			name:   "WfChecking",
+			format: "WfChecking",
+			input:  wellsFargoCSV,
+			expected: []ParsedTransaction{
+				{PostedDate: "2025-12-01", Amount: 1234, Description: "PURCHASE AUTHORIZED ON 11/30 KROGER", Beneficiary: "Us", Line: 1},
+				{PostedDate: "2025-12-02", Amount: -250000, Description: "PAYROLL DEPOSIT", Beneficiary: "Us", Line: 2},
+				{PostedDate: "2025-12-03", Amount: 10000, Description: "CHECK # 1234", Beneficiary: "Us", CheckNumber: "1234", Line: 3},
+			},
+			rejected: []RejectedRow{
+				{Line: 4, Raw: "12/04/2025,-1.00", Reason: "expected at least 5 fields, found 2"},
+			},
+		},
+		{
+			name:   "WfVisa",
+			format: "WfVisa",
+			input:  wellsFargoCSV,
+			expected: []ParsedTransaction{
+				{PostedDate: "2025-12-01", Amount: 1234, Description: "PURCHASE AUTHORIZED ON 11/30 KROGER", Beneficiary: "Us", Line: 1},
+				{PostedDate: "2025-12-02", Amount: -250000, Description: "PAYROLL DEPOSIT", Beneficiary: "Us", Line: 2},
+				{PostedDate: "2025-12-03", Amount: 10000, Description: "CHECK # 1234", Beneficiary: "Us", CheckNumber: "1234", Line: 3},
+			},
+			rejected: []RejectedRow{
+				{Line: 4, Raw: "12/04/2025,-1.00", Reason: "expected at least 5 fields, found 2"},
+			},
+		},
+	}
+
+	s := setupTestService(t)
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			parser, err := GetParser(s.DB, tc.format, "download.csv")
+			require.NoError(t, err)
+
+			got, err := ParseAll(parser, strings.NewReader(tc.input))
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, withoutSourceRows(got.Accepted))
+			assert.Equal(t, tc.rejected, got.Rejected)
+		})
+	}
+}
+
+func TestCSVParser_SourceRow(t *testing.T) {
+	s := setupTestService(t)
+
+	// Columns are keyed by header, including the ones the format doesn't use
+	parser, err := GetParser(s.DB, "CapitalOne", "download.csv")
+	require.NoError(t, err)
+	got, err := ParseAll(parser, strings.NewReader(capitalOneCSV))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"Transaction Date":"2025-12-20","Posted Date":"2025-12-22","Card No.":"3028",
+		"Description":"KROGER #123","Category":"Groceries","Debit":"19.99","Credit":""}`, got.Accepted[0].SourceRow)
+
+	// Without a header, by index
+	parser, err = GetParser(s.DB, "WfChecking", "download.csv")
+	require.NoError(t, err)
+	got, err = ParseAll(parser, strings.NewReader(wellsFargoCSV))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"0":"12/03/2025","1":"-100.00","2":"*","3":"1234","4":"CHECK # 1234"}`, got.Accepted[2].SourceRow)
+}
+
+// withoutSourceRows clears the SourceRow of parsed transactions, for tests that aren't about it
+func withoutSourceRows(transactions []ParsedTransaction) []ParsedTransaction {
+	for i := range transactions {
+		transactions[i].SourceRow = ""
+	}
+	return transactions
+}
+
+func TestCSVParser_MalformedQuotes(t *testing.T) {
+	s := setupTestService(t)
+	parser, err := GetParser(s.DB, "WfChecking", "download.csv")
+	require.NoError(t, err)
+
+	input := `"12/01/2025","-12.34","*","","KROGER"
+"12/02/2025","-1.00","*",""bad"","QUOTES"
+"12/03/2025","-5.00","*","","SAFEWAY"
+`
+	got, err := ParseAll(parser, strings.NewReader(input))
+	require.NoError(t, err)
+	assert.Len(t, got.Accepted, 2)
+	require.Len(t, got.Rejected, 1)
+	assert.Equal(t, 2, got.Rejected[0].Line)
+}
+
+func TestCSVParser_ReadError(t *testing.T) {
+	s := setupTestService(t)
+	parser, err := GetParser(s.DB, "WfChecking", "download.csv")
+	require.NoError(t, err)
+
+	input := io.MultiReader(
+		strings.NewReader(`"12/01/2025","-12.34","*","","KROGER"`+"\n"),
+		iotest.ErrReader(errors.New("device removed")),
+	)
+	got, err := ParseAll(parser, input)
+	require.NoError(t, err)
+	assert.Len(t, got.Accepted, 1)
+	require.Len(t, got.Rejected, 1)
+	assert.Equal(t, 2, got.Rejected[0].Line)
+	assert.Contains(t, got.Rejected[0].Reason, "device removed")
+}
+
+func TestCSVParser_BadAmount(t *testing.T) {
+	s := setupTestService(t)
+	parser, err := GetParser(s.DB, "WfChecking", "download.csv")
+	require.NoError(t, err)
+
+	input := `"12/01/2025","-12.34","*","","KROGER"
+"12/02/2025","twelve","*","","BAD AMOUNT"
+`
+	got, err := ParseAll(parser, strings.NewReader(input))
+	require.NoError(t, err)
+	assert.Len(t, got.Accepted, 1)
+	assert.Equal(t, []RejectedRow{
+		{Line: 2, Raw: "12/02/2025,twelve,*,,BAD AMOUNT", Reason: `invalid amount "twelve": unexpected 't'`},
+	}, got.Rejected)
+}
+
+func TestGetParser_AccountFormat(t *testing.T) {
+	s := setupTestService(t)
+
+	// A custom format, referencing columns by header name
+	require.NoError(t, s.AddImportFormat(&models.ImportFormat{
+		Name:               "CreditUnion",
+		HeaderRows:         1,
+		MinColumns:         3,
+		DateLayouts:        "2 Jan 2006",
+		PostedDateColumn:   "Date",
+		DescriptionColumn:  "Memo",
+		AmountColumn:       "Amount",
+		ExternalIDColumn:   "Ref",
+		NegateAmount:       true,
+		DefaultBeneficiary: "Us",
+	}))
+	require.NoError(t, s.AddAccount(&models.Account{Name: "Savings", Beneficiary: "Us", ImportFormat: "CreditUnion", Currency: "EUR"}))
+
+	parser, err := GetParser(s.DB, "Savings", "download.csv")
+	require.NoError(t, err)
+
+	got, err := ParseAll(parser, strings.NewReader("Amount,Date,Memo,Ref\n-3.50,5 Jan 2026,COFFEE,X1\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []ParsedTransaction{
+		{PostedDate: "2026-01-05", Amount: 350, Currency: "EUR", Description: "COFFEE", Beneficiary: "Us", ExternalID: "X1", Line: 2,
+			SourceRow: `{"Amount":"-3.50","Date":"5 Jan 2026","Memo":"COFFEE","Ref":"X1"}`},
+	}, got.Accepted)
+
+	// Header doesn't have the named column
+	_, err = ParseAll(parser, strings.NewReader("Amount,When,Memo,Ref\n-3.50,5 Jan 2026,COFFEE,X1\n"))
+	assert.ErrorContains(t, err, `column "Date" not found`)
+}
+
+func TestGetParser_AccountBeneficiary(t *testing.T) {
+	s := setupTestService(t)
+
+	// A format without a default beneficiary gives rows the account's
+	require.NoError(t, s.AddImportFormat(&models.ImportFormat{
+		Name:              "CU",
+		HeaderRows:        1,
+		DateLayouts:       "2006-01-02",
+		PostedDateColumn:  "Date",
+		DescriptionColumn: "Memo",
+		AmountColumn:      "Amount",
+	}))
+	require.NoError(t, s.AddAccount(&models.Account{Name: "BobSavings", Beneficiary: "Bob", ImportFormat: "CU"}))
+
+	parser, err := GetParser(s.DB, "BobSavings", "download.csv")
+	require.NoError(t, err)
+	got, err := ParseAll(parser, strings.NewReader("Date,Memo,Amount\n2026-01-05,COFFEE,3.50\n"))
+	require.NoError(t, err)
+	require.Len(t, got.Accepted, 1)
+	assert.Equal(t, "Bob", got.Accepted[0].Beneficiary)
+}
+
+func TestGetParser_Unknown(t *testing.T) {
+	s := setupTestService(t)
+
+	_, err := GetParser(s.DB, "NoSuchAccount", "download.csv")
+	assert.ErrorContains(t, err, "no parser found for account NoSuchAccount")
+}
+
+func TestGetParser_CardBeneficiaries(t *testing.T) {
+	s := setupTestService(t)
+
+	// Bob's card is reissued, and he gets a second card ending like Jessie's
+	require.NoError(t, s.UpdateCardBeneficiary(
+		&models.CardBeneficiary{ID: 1},
+		&models.CardBeneficiary{Account: "CapitalOne", CardSuffix: "4411", Beneficiary: "Bob"}))
+	require.NoError(t, s.AddCardBeneficiary(&models.CardBeneficiary{Account: "CapitalOne", CardSuffix: "56539", Beneficiary: "Bob"}))
+
+	parser, err := GetParser(s.DB, "CapitalOne", "download.csv")
+	require.NoError(t, err)
+	input := "Transaction Date,Posted Date,Card No.,Description,Category,Debit,Credit\n" +
+		"2025-12-20,2025-12-22,4411,KROGER,Groceries,1.00,\n" +
+		"2025-12-20,2025-12-22,3028,SAFEWAY,Groceries,2.00,\n" +
+		"2025-12-20,2025-12-22,XXXX-56539,TARGET,Merchandise,3.00,\n" +
+		"2025-12-20,2025-12-22,6539,COSTCO,Groceries,4.00,\n"
+	got, err := ParseAll(parser, strings.NewReader(input))
+	require.NoError(t, err)
+	require.Len(t, got.Accepted, 4)
+	assert.Equal(t, "Bob", got.Accepted[0].Beneficiary, "reissued card")
+	assert.Equal(t, "Us", got.Accepted[1].Beneficiary, "old card no longer mapped")
+	assert.Equal(t, "Bob", got.Accepted[2].Beneficiary, "longest suffix wins")
+	assert.Equal(t, "Jessie", got.Accepted[3].Beneficiary)
+
+	// Cards belong to an account, another account's parser doesn't see them
+	parser, err = GetParser(s.DB, "WfVisa", "download.csv")
+	require.NoError(t, err)
+	assert.Empty(t, parser.(*CSVParser).Cards)
+
+	// Deleting the account deletes its cards
+	require.NoError(t, s.DB.Where("account = ?", "CapitalOne").Delete(&models.RawTransaction{}).Error)
+	require.NoError(t, s.DeleteAccount(&models.Account{Name: "CapitalOne"}))
+	cards, err := s.GetCardBeneficiaries()
+	require.NoError(t, err)
+	assert.Empty(t, cards)
+}
+
+func TestCheckNumberIn(t *testing.T) {
+	tests := map[string]string{
+		"CHECK # 1234":                           "1234",
+		"Check 0567":                             "0567",
+		"CHECK NO. 42 CLEARED":                   "42",
+		"CHECKCARD 1201 KROGER":                  "",
+		"PURCHASE AUTHORIZED ON 11/30 CHECK # 1": "",
+		"":                                       "",
+	}
+	for description, expected := range tests {
+		assert.Equal(t, expected, checkNumberIn(description), description)
+	}
+}
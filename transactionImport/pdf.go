@@ -0,0 +1,120 @@
+package transactionImport
+
+import (
+	"fmt"
+	"io"
+	"iter"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"wailts/models"
+)
+
+// PDFParser reads statements that are only available as PDF.  The text is
+// extracted a line at a time, and each line that matches the format's
+// LineRegex is a transaction.  Lines that don't match, like headings and
+// balances, are skipped; lines that match but don't parse are rejected.
+type PDFParser struct {
+	Format      models.ImportFormat
+	Beneficiary string // The account's, for formats without a default, see beneficiaryOrDefault
+	Currency    string // Currency of the account
+}
+
+// Rows reads the whole file, since PDF can't be read from start to end
+func (p *PDFParser) Rows(reader io.Reader) iter.Seq2[ParsedRow, error] {
+	return func(yield func(ParsedRow, error) bool) {
+		f := &p.Format
+		lineRegex, err := pdfLineRegex(f)
+		if err != nil {
+			yield(ParsedRow{}, err)
+			return
+		}
+
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			yield(ParsedRow{}, err)
+			return
+		}
+		lines, err := extractPDFText(data)
+		if err != nil {
+			yield(ParsedRow{}, err)
+			return
+		}
+
+		layouts := dateLayouts(f)
+		for i, line := range lines {
+			m := lineRegex.FindStringSubmatch(line.Text)
+			if m == nil {
+				continue
+			}
+			groups := make(map[string]string)
+			for j, name := range lineRegex.SubexpNames() {
+				if name != "" {
+					groups[name] = strings.TrimSpace(m[j])
+				}
+			}
+			if !yield(p.parseLine(layouts, i+1, line, groups), nil) {
+				return
+			}
+		}
+	}
+}
+
+// pdfLineRegex compiles a format's LineRegex, checking it has the groups a transaction needs
+func pdfLineRegex(f *models.ImportFormat) (*regexp.Regexp, error) {
+	if strings.TrimSpace(f.LineRegex) == "" {
+		return nil, fmt.Errorf("import format %s: no line regex for PDF statements", f.Name)
+	}
+	re, err := regexp.Compile(f.LineRegex)
+	if err != nil {
+		return nil, fmt.Errorf("import format %s: invalid line regex: %w", f.Name, err)
+	}
+	names := re.SubexpNames()
+	if !slices.Contains(names, "date") {
+		return nil, fmt.Errorf("import format %s: line regex has no (?P<date>...) group", f.Name)
+	}
+	if !slices.Contains(names, "amount") && !slices.Contains(names, "debit") && !slices.Contains(names, "credit") {
+		return nil, fmt.Errorf("import format %s: line regex has no amount, debit or credit group", f.Name)
+	}
+	return re, nil
+}
+
+// parseLine turns the parts of a matching line into a transaction, or rejects it
+func (p *PDFParser) parseLine(layouts []string, lineNo int, line PDFLine, groups map[string]string) ParsedRow {
+	f := &p.Format
+	postedDate, err := parseDate(groups["date"], layouts)
+	if err != nil {
+		return rejectRow(lineNo, line.Text, err.Error())
+	}
+
+	var amount models.Money
+	if _, ok := groups["amount"]; ok {
+		amount, err = ParseMoney(groups["amount"])
+	} else {
+		var debit, credit models.Money
+		debit, err = parseOptionalMoney(groups["debit"])
+		if err == nil {
+			credit, err = parseOptionalMoney(groups["credit"])
+		}
+		amount = debit - credit
+	}
+	if err != nil {
+		return rejectRow(lineNo, line.Text, err.Error())
+	}
+	if f.NegateAmount {
+		amount = -amount
+	}
+
+	description := groups["description"]
+	return ParsedRow{Transaction: ParsedTransaction{
+		PostedDate:  postedDate,
+		Amount:      amount,
+		Currency:    p.Currency,
+		Description: description,
+		Beneficiary: beneficiaryOrDefault(f.DefaultBeneficiary, p.Beneficiary),
+		CheckNumber: checkNumberIn(description),
+		Line:        lineNo,
+		SourceRow:   encodeSourceRow(map[string]string{"page": strconv.Itoa(line.Page), "text": line.Text}),
+	}}
+}
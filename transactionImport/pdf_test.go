@@ -0,0 +1,258 @@
+package transactionImport
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"wailts/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testPDF is a page of a generated PDF: its content stream, and whether to compress it
+type testPDF struct {
+	content  string
+	compress bool
+}
+
+// makePDF builds a PDF with one page per content stream.  The pages are
+// written to the file last to first, so only the page tree gives their order.
+func makePDF(t *testing.T, pages ...testPDF) []byte {
+	t.Helper()
+	var objects []string // Numbered from 1
+	add := func(body string) int {
+		objects = append(objects, body)
+		return len(objects)
+	}
+	catalog := add("") // Filled in once the page tree is built
+	tree := add("")
+	font := add("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>")
+
+	var kids []string
+	for i := len(pages) - 1; i >= 0; i-- {
+		data, filter := []byte(pages[i].content), ""
+		if pages[i].compress {
+			data, filter = deflate(t, data), " /Filter /FlateDecode"
+		}
+		contents := add(fmt.Sprintf("<< /Length %d%s >>\nstream\n%s\nendstream", len(data), filter, data))
+		page := add(fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 612 792] /Resources << /Font << /F1 %d 0 R >> >> /Contents %d 0 R >>",
+			tree, font, contents))
+		kids = append([]string{fmt.Sprintf("%d 0 R", page)}, kids...)
+	}
+	objects[catalog-1] = fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", tree)
+	objects[tree-1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(kids))
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objects))
+	for i, body := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, body)
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, o := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", o)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, catalog, xref)
+	return out.Bytes()
+}
+
+func deflate(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	w := zlib.NewWriter(&b)
+	_, err := w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return b.Bytes()
+}
+
+// makeObjStmPDF builds a one page PDF as newer generators write them: the
+// page tree, page and fonts are in a compressed object stream that only a
+// cross-reference stream finds, and the text is in a CID font whose codes
+// only its ToUnicode map makes readable.  Code n is character n+0x1F.
+func makeObjStmPDF(t *testing.T, lines ...string) []byte {
+	t.Helper()
+	var content strings.Builder
+	for i, l := range lines {
+		fmt.Fprintf(&content, "BT /F1 10 Tf 50 %d Td <", 750-14*i)
+		for _, c := range []byte(l) {
+			fmt.Fprintf(&content, "%04X", int(c)-0x1F)
+		}
+		content.WriteString("> Tj ET\n")
+	}
+	const toUnicode = "/CIDInit /ProcSet findresource begin 12 dict begin begincmap\n" +
+		"/CMapName /Adobe-Identity-UCS def /CMapType 2 def\n" +
+		"1 begincodespacerange <0000> <FFFF> endcodespacerange\n" +
+		"1 beginbfrange <0001> <005F> <0020> endbfrange\n" +
+		"endcmap CMapName currentdict /CMap defineresource pop end end\n"
+
+	// Objects 1-5 are in the object stream, 6 and 7 are streams, 8 is the object stream and 9 the cross-reference stream
+	compressed := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Resources << /Font << /F1 4 0 R >> >> /Contents 7 0 R >>",
+		"<< /Type /Font /Subtype /Type0 /BaseFont /ABCDEF+Statement /Encoding /Identity-H /DescendantFonts [5 0 R] /ToUnicode 6 0 R >>",
+		"<< /Type /Font /Subtype /CIDFontType2 /BaseFont /ABCDEF+Statement /CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> >>",
+	}
+	var header, body strings.Builder
+	for i, object := range compressed {
+		fmt.Fprintf(&header, "%d %d ", i+1, body.Len())
+		body.WriteString(object + "\n")
+	}
+	objStm := deflate(t, []byte(header.String()+body.String()))
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.5\n%\xe2\xe3\xcf\xd3\n")
+	offsets := map[int]int{}
+	stream := func(num int, dict string, data []byte) {
+		offsets[num] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n<< /Length %d %s >>\nstream\n%s\nendstream\nendobj\n", num, len(data), dict, data)
+	}
+	stream(6, "", []byte(toUnicode))
+	stream(7, "/Filter /FlateDecode", deflate(t, []byte(content.String())))
+	stream(8, fmt.Sprintf("/Type /ObjStm /N %d /First %d /Filter /FlateDecode", len(compressed), header.Len()), objStm)
+
+	// Entries are a type byte, then 4 bytes of offset or object stream, then 2 of generation or index
+	var xref bytes.Buffer
+	entry := func(kind byte, field2 int, field3 int) {
+		xref.Write([]byte{kind, byte(field2 >> 24), byte(field2 >> 16), byte(field2 >> 8), byte(field2), byte(field3 >> 8), byte(field3)})
+	}
+	offsets[9] = out.Len()
+	entry(0, 0, 65535)
+	for i := range compressed {
+		entry(2, 8, i)
+	}
+	for num := 6; num <= 9; num++ {
+		entry(1, offsets[num], 0)
+	}
+	stream(9, "/Type /XRef /Size 10 /W [1 4 2] /Root 1 0 R", xref.Bytes())
+	fmt.Fprintf(&out, "startxref\n%d\n%%%%EOF\n", offsets[9])
+	return out.Bytes()
+}
+
+// textLines is a content stream showing each line below the last, as statement generators write them
+func textLines(lines ...string) string {
+	var b strings.Builder
+	b.WriteString("BT /F1 10 Tf 14 TL 50 750 Td\n")
+	for _, l := range lines {
+		l = strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`).Replace(l)
+		fmt.Fprintf(&b, "(%s) Tj T*\n", l)
+	}
+	b.WriteString("ET\n")
+	return b.String()
+}
+
+func TestExtractPDFText(t *testing.T) {
+	pdf := makePDF(t,
+		testPDF{content: textLines("First National Bank", "Statement (December)")},
+		testPDF{
+			// Columns placed separately, out of order, and a TJ array with kerning and a word gap
+			content: "BT /F1 10 Tf 400 700 Td (-12.34) Tj ET\n" +
+				"BT /F1 10 Tf 50 700 Td (12/01/2025) Tj 80 0 Td [(KRO) 20 (GER) -300 (#12\\063)] TJ ET\n" +
+				"BT /F1 10 Tf 1 0 0 1 50 720 Tm <446174652020> Tj ET\n",
+			compress: true,
+		},
+	)
+
+	lines, err := extractPDFText(pdf)
+	require.NoError(t, err)
+	assert.Equal(t, []PDFLine{
+		{Page: 1, Text: "First National Bank"},
+		{Page: 1, Text: "Statement (December)"},
+		{Page: 2, Text: "Date"},
+		{Page: 2, Text: "12/01/2025 KROGER #123 -12.34"},
+	}, lines)
+
+	lines, err = extractPDFText(makeObjStmPDF(t, "Statement (December)", "12/01/2025 KROGER #123 -12.34"))
+	require.NoError(t, err)
+	assert.Equal(t, []PDFLine{
+		{Page: 1, Text: "Statement (December)"},
+		{Page: 1, Text: "12/01/2025 KROGER #123 -12.34"},
+	}, lines)
+
+	_, err = extractPDFText([]byte("Date,Amount\n"))
+	assert.ErrorContains(t, err, "not a PDF file")
+
+	_, err = extractPDFText(makePDF(t, testPDF{content: "q 100 0 0 100 0 0 cm Q\n"}))
+	assert.ErrorContains(t, err, "no text found")
+}
+
+func TestPDFParser(t *testing.T) {
+	s := setupTestService(t)
+	require.NoError(t, s.AddImportFormat(&models.ImportFormat{
+		Name:               "OldBankPDF",
+		DateLayouts:        "01/02/2006",
+		LineRegex:          `^(?P<date>\d\d/\d\d/\d{4})\s+(?P<description>.+?)\s+(?P<amount>-?[\d,]+\.\d\d)$`,
+		NegateAmount:       true,
+		DefaultBeneficiary: "Us",
+	}))
+	require.NoError(t, s.AddAccount(&models.Account{Name: "OldSavings", Beneficiary: "Us", ImportFormat: "OldBankPDF"}))
+
+	pdf := makePDF(t, testPDF{content: textLines(
+		"Old Bank Statement",
+		"Date Description Amount",
+		"12/01/2025 KROGER #123 -12.34",
+		"12/02/2025 PAYROLL DEPOSIT 2,500.00",
+		"13/45/2025 BAD DATE -1.00",
+		"Closing balance 2,487.66",
+	)}, testPDF{content: textLines("12/03/2025 CHECK # 1234 -100.00")})
+
+	parser, err := GetParser(s.DB, "OldSavings", "statement.pdf")
+	require.NoError(t, err)
+	got, err := ParseAll(parser, bytes.NewReader(pdf))
+	require.NoError(t, err)
+
+	assert.Equal(t, []ParsedTransaction{
+		{PostedDate: "2025-12-01", Amount: 1234, Description: "KROGER #123", Beneficiary: "Us", Line: 3},
+		{PostedDate: "2025-12-02", Amount: -250000, Description: "PAYROLL DEPOSIT", Beneficiary: "Us", Line: 4},
+		{PostedDate: "2025-12-03", Amount: 10000, Description: "CHECK # 1234", Beneficiary: "Us", CheckNumber: "1234", Line: 7},
+	}, withoutSourceRows(got.Accepted))
+	assert.Equal(t, []RejectedRow{
+		{Line: 5, Raw: "13/45/2025 BAD DATE -1.00", Reason: "unable to parse date: 13/45/2025"},
+	}, got.Rejected)
+
+	got, err = ParseAll(parser, bytes.NewReader(pdf))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"page":"2","text":"12/03/2025 CHECK # 1234 -100.00"}`, got.Accepted[2].SourceRow)
+
+	// An account whose format has no line regex can't read PDFs
+	_, err = GetParser(s.DB, "WfChecking", "statement.pdf")
+	assert.ErrorContains(t, err, "doesn't read PDF statements")
+}
+
+func TestImporter_ImportPDF(t *testing.T) {
+	s := setupTestService(t)
+	require.NoError(t, s.AddImportFormat(&models.ImportFormat{
+		Name:        "OldBankPDF",
+		DateLayouts: "2006-01-02",
+		LineRegex:   `^(?P<date>\d{4}-\d\d-\d\d) (?P<description>.+) (?P<debit>[\d.]+)$`,
+	}))
+	require.NoError(t, s.AddAccount(&models.Account{Name: "OldSavings", Beneficiary: "Bob", ImportFormat: "OldBankPDF"}))
+
+	dir := t.TempDir()
+	download := filepath.Join(dir, "statement.pdf")
+	require.NoError(t, os.WriteFile(download, makePDF(t, testPDF{content: textLines("2026-01-02 BAKERY 4.50")}), 0644))
+
+	// The account is detected from the whole file
+	account, _, err := DetectAccount(s.DB, download)
+	require.NoError(t, err)
+	assert.Equal(t, "OldSavings", account)
+
+	im := &Importer{DB: s.DB, ArchiveDir: filepath.Join(dir, "importHistory")}
+	report, err := im.ImportFile("", download, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "Imported 1 records", report.Message)
+
+	// The format has no default beneficiary, so the row is the account's
+	raws, err := s.GetRawTransactions()
+	require.NoError(t, err)
+	require.Len(t, raws, 1)
+	assert.Equal(t, "Bob", raws[0].Beneficiary)
+}
@@ -0,0 +1,113 @@
+package transactionImport
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// PDFLine is a line of text on a page of a PDF
+type PDFLine struct {
+	Page int // 1-based
+	Text string
+}
+
+// extractPDFText returns the text of a PDF a line at a time, top to bottom of each page.
+//
+// Reading the file is left to github.com/ledongthuc/pdf, which follows
+// cross-reference streams and object streams and decodes text through the
+// fonts' encodings and ToUnicode maps.  Scanned statements have no text at all.
+func extractPDFText(data []byte) ([]PDFLine, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data, "\x00\t\r\n "), []byte("%PDF-")) {
+		return nil, errors.New("not a PDF file")
+	}
+	r, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the PDF: %w", err)
+	}
+
+	var lines []PDFLine
+	for i := 1; i <= r.NumPage(); i++ {
+		glyphs, err := pdfPageGlyphs(r.Page(i))
+		if err != nil {
+			return nil, fmt.Errorf("page %d: %w", i, err)
+		}
+		for _, text := range pdfLines(glyphs) {
+			lines = append(lines, PDFLine{Page: i, Text: text})
+		}
+	}
+	if len(lines) == 0 {
+		return nil, errors.New("no text found in the PDF; scanned statements can't be imported")
+	}
+	return lines, nil
+}
+
+// pdfPageGlyphs returns the characters a page shows, where it shows them.
+// The library panics on content it can't interpret, which is an error here.
+func pdfPageGlyphs(page pdf.Page) (glyphs []pdf.Text, err error) {
+	if page.V.IsNull() {
+		return nil, nil
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("failed to read the page's content: %v", r)
+		}
+	}()
+	return page.Content().Text, nil
+}
+
+// pdfLines joins characters with the same baseline into lines, top of the
+// page first, then left to right.  Characters are kept in runs in the order
+// shown, as fonts without widths put a whole string at one place and kerning
+// may then move text back a little; a run ends where text jumps back to the
+// left, as when columns are shown out of order.  A gap wider than a fifth of
+// the font size is a space.
+func pdfLines(glyphs []pdf.Text) []string {
+	shown := make([]pdf.Text, 0, len(glyphs))
+	for _, g := range glyphs {
+		if g.S != "" && !strings.ContainsFunc(g.S, unicode.IsControl) {
+			shown = append(shown, g)
+		}
+	}
+	sort.SliceStable(shown, func(i, j int) bool { return shown[i].Y > shown[j].Y })
+
+	var lines []string
+	for start := 0; start < len(shown); {
+		end := start + 1
+		for end < len(shown) && shown[end-1].Y-shown[end].Y < 1 {
+			end++
+		}
+
+		var runs [][]pdf.Text
+		for i, g := range shown[start:end] {
+			if i == 0 || g.X < shown[start+i-1].X-g.FontSize/2 {
+				runs = append(runs, nil)
+			}
+			runs[len(runs)-1] = append(runs[len(runs)-1], g)
+		}
+		sort.SliceStable(runs, func(i, j int) bool { return runs[i][0].X < runs[j][0].X })
+
+		var b strings.Builder
+		var prev *pdf.Text
+		for _, run := range runs {
+			for i := range run {
+				g := &run[i]
+				if prev != nil && g.X-(prev.X+prev.W) > g.FontSize/5 && prev.S != " " && g.S != " " {
+					b.WriteByte(' ')
+				}
+				b.WriteString(g.S)
+				prev = g
+			}
+		}
+		if text := strings.Join(strings.Fields(b.String()), " "); text != "" {
+			lines = append(lines, text)
+		}
+		start = end
+	}
+	return lines
+}
@@ -0,0 +1,130 @@
+package transactionImport
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"wailts/models"
+
+	"gorm.io/gorm"
+)
+
+// errPreviewDone rolls back the transaction a preview runs in
+var errPreviewDone = errors.New("preview done")
+
+// FieldChange is a field of an existing Transaction that an import would change
+type FieldChange struct {
+	Field string
+	Old   string
+	New   string
+}
+
+// PreviewRow is a row of the staging area as an import would leave it
+type PreviewRow struct {
+	Row      models.RawTransaction
+	Restaged bool          // The row is already in the staging area, and would be refreshed
+	Changes  []FieldChange // For an update, the fields of the Transaction that finalizing would change
+}
+
+// ImportPreview is what importing a file would do, without doing it
+type ImportPreview struct {
+	Message    string
+	Account    string
+	Added      []PreviewRow  // New transactions
+	Updated    []PreviewRow  // Updates to existing transactions
+	Duplicates []PreviewRow  // New transactions that are probably duplicates of existing rows
+	Rejected   []RejectedRow // Rows that would be dropped, and why
+	Warnings   []string      // E.g. the file was imported before
+}
+
+// PreviewImport works out what ImportFile would do with a file by importing it
+// inside a transaction that is always rolled back.  Nothing is archived.
+func (im *Importer) PreviewImport(account string, filePath string) (*ImportPreview, error) {
+	plan, err := im.plan(account, filePath)
+	if err != nil {
+		return nil, err
+	}
+	preview := &ImportPreview{Account: plan.account, Warnings: plan.warnings}
+
+	err = im.DB.Transaction(func(tx *gorm.DB) error {
+		batch := models.ImportBatch{FileName: filePath, FileHash: plan.hash, Account: plan.account}
+		if err := tx.Create(&batch).Error; err != nil {
+			return err
+		}
+		processor := NewProcessor(tx, plan.account, batch.ID)
+		rejected, err := im.stream(plan.parser, processor, &batch, filePath, nil)
+		if err != nil {
+			return err
+		}
+		preview.Rejected = rejected
+
+		if err := preview.addRows(tx, processor, batch.ID); err != nil {
+			return err
+		}
+		return errPreviewDone
+	})
+	if !errors.Is(err, errPreviewDone) {
+		return nil, err
+	}
+
+	preview.Message = fmt.Sprintf("Would add %d, update %d, flag %d as probable duplicates and reject %d rows",
+		len(preview.Added), len(preview.Updated), len(preview.Duplicates), len(preview.Rejected))
+	return preview, nil
+}
+
+// addRows sorts the rows the processor staged into the preview's lists
+func (preview *ImportPreview) addRows(tx *gorm.DB, processor *Processor, batchID uint) error {
+	ids := slices.Sorted(maps.Keys(processor.stagedRaw))
+	for chunk := range slices.Chunk(ids, ProcessChunkSize) {
+		var rows []models.RawTransaction
+		if err := tx.Where("id IN ?", chunk).Order("id").Find(&rows).Error; err != nil {
+			return err
+		}
+		for _, r := range rows {
+			row := PreviewRow{Row: r, Restaged: r.ImportBatchID == nil || *r.ImportBatchID != batchID}
+			switch {
+			case r.Action == "update":
+				var existing models.Transaction
+				if err := tx.First(&existing, r.TransactionID).Error; err != nil {
+					return err
+				}
+				updated := existing
+				updated.UpdateFromRaw(&r)
+				row.Changes = diffTransactions(&existing, &updated)
+				preview.Updated = append(preview.Updated, row)
+			case r.DuplicateConfidence > 0:
+				preview.Duplicates = append(preview.Duplicates, row)
+			default:
+				preview.Added = append(preview.Added, row)
+			}
+		}
+	}
+	return nil
+}
+
+// diffTransactions lists the fields that differ between two versions of a transaction
+func diffTransactions(old, new *models.Transaction) []FieldChange {
+	fields := []struct {
+		name     string
+		old, new any
+	}{
+		{"PostedDate", old.PostedDate, new.PostedDate},
+		{"TransactionDate", old.TransactionDate, new.TransactionDate},
+		{"Amount", old.Amount.String(), new.Amount.String()},
+		{"Description", old.Description, new.Description},
+		{"Budget", old.Budget, new.Budget},
+		{"Beneficiary", old.Beneficiary, new.Beneficiary},
+		{"RawHint", old.RawHint, new.RawHint},
+		{"ExternalID", old.ExternalID, new.ExternalID},
+		{"CheckNumber", old.CheckNumber, new.CheckNumber},
+		{"Memo", old.Memo, new.Memo},
+	}
+	var changes []FieldChange
+	for _, f := range fields {
+		if f.old != f.new {
+			changes = append(changes, FieldChange{Field: f.name, Old: fmt.Sprint(f.old), New: fmt.Sprint(f.new)})
+		}
+	}
+	return changes
+}
@@ -0,0 +1,69 @@
+package transactionImport
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"wailts/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImporter_PreviewImport(t *testing.T) {
+	s := setupTestService(t)
+	dir := t.TempDir()
+	im := &Importer{DB: s.DB, ArchiveDir: filepath.Join(dir, "importHistory")}
+
+	// Already finalized, without a beneficiary
+	require.NoError(t, s.DB.Create(&models.Transaction{
+		PostedDate: "2025-12-02", Account: "WfChecking", Amount: -250000, Description: "PAYROLL DEPOSIT",
+		Beneficiary: models.PLACEHOLDER_BENEFICIARY, Budget: models.PLACEHOLDER_BUDGET,
+	}).Error)
+	// Already staged, by a download that spelled the store differently
+	require.NoError(t, s.DB.Create(&models.RawTransaction{
+		PostedDate: "2025-12-01", Account: "WfChecking", Amount: 1234, Description: "KROGER", Action: "add",
+	}).Error)
+
+	download := filepath.Join(dir, "Checking1.csv")
+	require.NoError(t, os.WriteFile(download, []byte(wellsFargoCSV), 0644))
+
+	preview, err := im.PreviewImport("WfChecking", download)
+	require.NoError(t, err)
+	assert.Equal(t, "Would add 1, update 1, flag 1 as probable duplicates and reject 1 rows", preview.Message)
+
+	require.Len(t, preview.Added, 1)
+	assert.Equal(t, "CHECK # 1234", preview.Added[0].Row.Description)
+	assert.False(t, preview.Added[0].Restaged)
+
+	require.Len(t, preview.Updated, 1)
+	assert.Equal(t, []FieldChange{{Field: "Beneficiary", Old: models.PLACEHOLDER_BENEFICIARY, New: "Us"}}, preview.Updated[0].Changes)
+
+	require.Len(t, preview.Duplicates, 1)
+	assert.Equal(t, "PURCHASE AUTHORIZED ON 11/30 KROGER", preview.Duplicates[0].Row.Description)
+	assert.NotZero(t, preview.Duplicates[0].Row.DuplicateOfRaw)
+
+	require.Len(t, preview.Rejected, 1)
+	assert.Equal(t, 4, preview.Rejected[0].Line)
+
+	// Nothing was imported or archived
+	raws, err := s.GetRawTransactions()
+	require.NoError(t, err)
+	assert.Len(t, raws, 1)
+	batches, err := s.GetImportBatches()
+	require.NoError(t, err)
+	assert.Empty(t, batches)
+	assert.NoDirExists(t, im.ArchiveDir)
+
+	// Previewing the real import shows the staged rows being refreshed
+	_, err = im.ImportFile("WfChecking", download, nil)
+	require.NoError(t, err)
+	preview, err = im.PreviewImport("WfChecking", download)
+	require.NoError(t, err)
+	require.Len(t, preview.Warnings, 1)
+	for _, rows := range [][]PreviewRow{preview.Added, preview.Updated, preview.Duplicates} {
+		for _, r := range rows {
+			assert.True(t, r.Restaged, r.Row.Description)
+		}
+	}
+}
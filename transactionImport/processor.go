@@ -2,88 +2,390 @@ package transactionImport
 
 import (
 	"fmt"
+	"slices"
+	"time"
 	"wailts/models"
 
 	"gorm.io/gorm"
 )
 
-// ProcessRaw imports parsed transactions into the RawTransaction table
-func ProcessRaw(db *gorm.DB, account string, transactions []ParsedTransaction) error {
-	// 1. Fetch existing Transactions for this account to determine "add" vs "update"
-	// Optimization: we could filter by date range of the new transactions
-	var existingTransactions []models.Transaction
-	if err := db.Where("account = ?", account).Find(&existingTransactions).Error; err != nil {
+// ProcessSummary counts what ProcessRaw did with the parsed transactions
+type ProcessSummary struct {
+	Added      int // New rows in raw_transactions
+	Updated    int // Existing rows in raw_transactions updated
+	Duplicates int // Rows flagged as probable duplicates
+}
+
+// ProcessChunkSize is how many parsed transactions a Processor stages at a time
+var ProcessChunkSize = 500
+
+// createBatchSize is how many new rows go in one INSERT, well within SQLite's limit on parameters
+const createBatchSize = 100
+
+// RowError is a failure to stage one row of a file
+type RowError struct {
+	Row         int // 1-based position of the row among the file's accepted transactions
+	Transaction ParsedTransaction
+	Err         error
+}
+
+func (e *RowError) Error() string {
+	where := fmt.Sprintf("row %d", e.Row)
+	if e.Transaction.Line > 0 {
+		where = fmt.Sprintf("line %d", e.Transaction.Line)
+	}
+	return fmt.Sprintf("failed to stage %s (%s %s %s): %v", where,
+		e.Transaction.PostedDate, e.Transaction.Amount, e.Transaction.Description, e.Err)
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// ProcessRaw imports parsed transactions into the RawTransaction table.
+// New rows are linked to the ImportBatch batchID (0 for none); rows already
+// staged stay linked to the import that created them.
+// It's all or nothing: if any row fails, a *RowError says which and nothing is staged.
+func ProcessRaw(db *gorm.DB, account string, batchID uint, transactions []ParsedTransaction) (*ProcessSummary, error) {
+	var summary *ProcessSummary
+	err := db.Transaction(func(tx *gorm.DB) error {
+		p := NewProcessor(tx, account, batchID)
+		for chunk := range slices.Chunk(transactions, ProcessChunkSize) {
+			if err := p.Add(chunk); err != nil {
+				return err
+			}
+		}
+		var err error
+		summary, err = p.Finish()
 		return err
+	})
+	if err != nil {
+		return nil, err
 	}
+	return summary, nil
+}
 
-	// Index existing transactions for fast lookup
-	// Key: Date|Amount|Description (Account is fixed)
-	transactionMap := make(map[string]bool)
-	for _, t := range existingTransactions {
-		key := generateKey(t.PostedDate, t.Amount, t.Description)
-		transactionMap[key] = true
+// Processor stages the transactions of one file into the RawTransaction table,
+// a chunk at a time, so a long file never needs all of the account's existing
+// rows in memory: each chunk is matched against only the existing rows
+// within its date range.  Probable duplicates are looked for by Finish,
+// once every row of the file has had the chance to match exactly.
+//
+// Give it a transaction, so a failure part way through a file can be rolled back.
+type Processor struct {
+	db      *gorm.DB
+	account string
+	batchID uint
+	summary ProcessSummary
+
+	// What earlier chunks did, so later ones carry on where they left off
+	occurrences         map[string]int // Rows seen so far with each Date|Amount|Description key
+	matchedTransactions map[uint]bool  // Existing transactions that a row has matched
+	stagedRaw           map[uint]bool  // Raw rows matched or added by this file
+	unmatched           []uint         // Raw rows that matched no transaction, which may be duplicates
+	rows                int            // Rows added in earlier chunks
+}
+
+// NewProcessor starts processing a file downloaded from account.
+// New rows are linked to the ImportBatch batchID (0 for none).
+func NewProcessor(db *gorm.DB, account string, batchID uint) *Processor {
+	return &Processor{
+		db:                  db,
+		account:             account,
+		batchID:             batchID,
+		occurrences:         make(map[string]int),
+		matchedTransactions: make(map[uint]bool),
+		stagedRaw:           make(map[uint]bool),
 	}
-	fmt.Printf("[Processor] Loaded %d existing transactions for account %s\n", len(existingTransactions), account)
+}
 
-	// 2. Fetch existing RawTransactions to ensure idempotency (update instead of duplicate)
-	var existingRaw []models.RawTransaction
-	if err := db.Where("account = ?", account).Find(&existingRaw).Error; err != nil {
+// Finish flags the rows that are probable duplicates of rows the file
+// didn't match exactly, and returns the counts for the whole file
+func (p *Processor) Finish() (*ProcessSummary, error) {
+	for ids := range slices.Chunk(p.unmatched, ProcessChunkSize) {
+		if err := p.flagDuplicates(ids); err != nil {
+			return nil, err
+		}
+	}
+	summary := p.summary
+	return &summary, nil
+}
+
+// flagDuplicates looks for probable duplicates of some of the unmatched rows
+func (p *Processor) flagDuplicates(ids []uint) error {
+	var rows []models.RawTransaction
+	if err := p.db.Where("id IN ?", ids).Order("id").Find(&rows).Error; err != nil {
 		return err
 	}
+	if len(rows) == 0 {
+		return nil
+	}
+	parsed := make([]ParsedTransaction, len(rows))
+	for i, r := range rows {
+		parsed[i] = ParsedTransaction{PostedDate: r.PostedDate, Amount: r.Amount, Description: r.Description}
+	}
 
-	rawMap := make(map[string]uint) // Key -> ID
+	// Rows that no incoming row matches exactly may still be the same transaction, slightly changed
+	from, to := dateRange(parsed, DuplicateWindowDays)
+	duplicates := newDuplicateFinder()
+	var existingTransactions []models.Transaction
+	if err := p.db.Where("account = ? AND posted_date BETWEEN ? AND ?", p.account, from, to).
+		Order("id").Find(&existingTransactions).Error; err != nil {
+		return err
+	}
+	for _, t := range existingTransactions {
+		if !p.matchedTransactions[t.ID] {
+			duplicates.add(duplicateCandidate{transactionID: t.ID, date: t.PostedDate, amount: t.Amount, description: t.Description})
+		}
+	}
+	var existingRaw []models.RawTransaction
+	if err := p.db.Where("account = ? AND posted_date BETWEEN ? AND ?", p.account, from, to).
+		Order("id").Find(&existingRaw).Error; err != nil {
+		return err
+	}
 	for _, r := range existingRaw {
-		key := generateKey(r.PostedDate, r.Amount, r.Description)
-		rawMap[key] = r.ID
+		if !p.stagedRaw[r.ID] {
+			duplicates.add(duplicateCandidate{rawID: r.ID, date: r.PostedDate, amount: r.Amount, description: r.Description})
+		}
 	}
-	fmt.Printf("[Processor] Loaded %d existing raw transactions\n", len(existingRaw))
 
-	// 3. Process each parsed transaction
-	added := 0
-	updated := 0
+	for i, r := range rows {
+		dup, confidence := duplicates.best(parsed[i])
+		if dup == nil {
+			continue
+		}
+		if err := p.db.Model(&models.RawTransaction{}).Where("id = ?", r.ID).Updates(map[string]any{
+			"duplicate_of_transaction": dup.transactionID,
+			"duplicate_of_raw":         dup.rawID,
+			"duplicate_confidence":     confidence,
+		}).Error; err != nil {
+			return err
+		}
+		p.summary.Duplicates++
+	}
+	return nil
+}
+
+// Add stages the next chunk of the file's transactions
+func (p *Processor) Add(transactions []ParsedTransaction) error {
+	if len(transactions) == 0 {
+		return nil
+	}
+
+	// 1. Fetch the existing Transactions and RawTransactions on the chunk's dates,
+	// or with its bank IDs in case the bank changed a date, to determine "add" vs "update"
+	from, to := dateRange(transactions, 0)
+	var externalIDs []string
 	for _, pt := range transactions {
+		if pt.ExternalID != "" {
+			externalIDs = append(externalIDs, pt.ExternalID)
+		}
+	}
+	const nearby = "account = ? AND (posted_date BETWEEN ? AND ? OR external_id IN ?)"
+	var existingTransactions []models.Transaction
+	if err := p.db.Where(nearby, p.account, from, to, externalIDs).Order("id").Find(&existingTransactions).Error; err != nil {
+		return err
+	}
+	var existingRaw []models.RawTransaction
+	if err := p.db.Where(nearby, p.account, from, to, externalIDs).Order("id").Find(&existingRaw).Error; err != nil {
+		return err
+	}
+	// Index existing rows for fast lookup
+	// Key: bank's ID if it supplied one, else Date|Amount|Description|Occurrence (Account is fixed)
+	transactionIndex := newKeyIndex()
+	for _, t := range existingTransactions {
+		transactionIndex.add(t.ID, t.PostedDate, t.Amount, t.Description, t.ExternalID)
+	}
+	rawIndex := newKeyIndex()
+	rawByID := make(map[uint]*models.RawTransaction, len(existingRaw))
+	for i, r := range existingRaw {
+		rawIndex.add(r.ID, r.PostedDate, r.Amount, r.Description, r.ExternalID)
+		rawByID[r.ID] = &existingRaw[i]
+	}
+
+	// 2. Find the exact match, if any, for each parsed transaction.
+	// The nth identical row on a date in the file matches the nth identical existing row.
+	// Raw rows added by earlier chunks take the place of the occurrence that added them.
+	type match struct {
+		transactionID, rawID uint
+	}
+	matches := make([]match, len(transactions))
+	for i, pt := range transactions {
 		key := generateKey(pt.PostedDate, pt.Amount, pt.Description)
+		n := p.occurrences[key]
+		p.occurrences[key]++
 
-		// Determine Action
-		action := "add"
-		if transactionMap[key] {
-			action = "update"
+		if id, exists := transactionIndex.find(pt.PostedDate, pt.Amount, pt.Description, pt.ExternalID, n); exists {
+			matches[i].transactionID = id
+			p.matchedTransactions[id] = true
+		}
+		if id, exists := rawIndex.find(pt.PostedDate, pt.Amount, pt.Description, pt.ExternalID, n); exists {
+			matches[i].rawID = id
+			p.stagedRaw[id] = true
 		}
+	}
 
+	// 3. Process each parsed transaction, updating staged rows as we go and adding new ones in one batch
+	var added []models.RawTransaction
+	var addedFrom []int // Index in transactions of each added row
+	for i, pt := range transactions {
 		// Prepare model
 		raw := models.RawTransaction{
-			PostedDate:  pt.PostedDate,
-			Account:     account,
-			Amount:      pt.Amount,
-			Description: pt.Description,
-			Beneficiary: pt.Beneficiary,
-			RawHint:     pt.RawHint,
-			Action:      action,
+			PostedDate:      pt.PostedDate,
+			TransactionDate: pt.TransactionDate,
+			Account:         p.account,
+			Amount:          pt.Amount,
+			Currency:        pt.Currency,
+			Description:     pt.Description,
+			Beneficiary:     pt.Beneficiary,
+			RawHint:         pt.RawHint,
+			ExternalID:      pt.ExternalID,
+			CheckNumber:     pt.CheckNumber,
+			Memo:            pt.Memo,
+			SourceFile:      pt.SourceFile,
+			SourceLine:      pt.Line,
+			SourceRow:       pt.SourceRow,
+			Action:          "add",
 			// Budget: is imported as empty string, user must set to somethingh non-empty to load into transactions.
 		}
 
+		// Determine Action
+		if matches[i].transactionID != 0 {
+			raw.Action = "update"
+			raw.TransactionID = matches[i].transactionID
+		}
+
 		// Check if we already have this in Raw
-		if rawID, exists := rawMap[key]; exists {
-			// Update existing Raw record
-			raw.ID = rawID
-			if err := db.Save(&raw).Error; err != nil {
-				return err
+		if matches[i].rawID != 0 {
+			// Update existing Raw record, keeping what it was for rolling the import back
+			raw.ID = matches[i].rawID
+			if p.batchID != 0 {
+				if err := models.RecordImportChange(p.db, p.batchID, rawByID[raw.ID]); err != nil {
+					return p.rowError(i, pt, err)
+				}
+			}
+			// What the user gave the row isn't in the file, so it stays
+			if err := p.db.Omit("CreatedAt", "ImportBatchID", "Budget", "Tag", "ProposedSplits").Save(&raw).Error; err != nil {
+				return p.rowError(i, pt, err)
+			}
+			p.summary.Updated++
+			if raw.TransactionID == 0 {
+				p.unmatched = append(p.unmatched, raw.ID)
 			}
-			updated++
 		} else {
 			// Create new
-			if err := db.Create(&raw).Error; err != nil {
-				return err
+			if p.batchID != 0 {
+				raw.ImportBatchID = &p.batchID
 			}
-			rawMap[key] = raw.ID
-			added++
+			added = append(added, raw)
+			addedFrom = append(addedFrom, i)
 		}
 	}
-	fmt.Printf("[Processor] Processing complete. Added: %d, Updated: %d\n", added, updated)
 
+	if err := p.create(added, addedFrom, transactions); err != nil {
+		return err
+	}
+	for _, raw := range added {
+		p.stagedRaw[raw.ID] = true
+		p.summary.Added++
+		if raw.TransactionID == 0 {
+			p.unmatched = append(p.unmatched, raw.ID)
+		}
+	}
+	p.rows += len(transactions)
 	return nil
 }
 
+// create inserts new raw rows in batches.  If a batch fails, the rows are
+// inserted one at a time to find the one at fault.
+func (p *Processor) create(added []models.RawTransaction, addedFrom []int, transactions []ParsedTransaction) error {
+	if len(added) == 0 {
+		return nil
+	}
+	err := p.db.CreateInBatches(&added, createBatchSize).Error
+	if err == nil {
+		return nil
+	}
+	for j := range added {
+		added[j].ID = 0
+		if rowErr := p.db.Create(&added[j]).Error; rowErr != nil {
+			i := addedFrom[j]
+			return p.rowError(i, transactions[i], rowErr)
+		}
+	}
+	return err
+}
+
+// rowError identifies the i'th row of the current chunk as the one that failed
+func (p *Processor) rowError(i int, pt ParsedTransaction, err error) error {
+	return &RowError{Row: p.rows + i + 1, Transaction: pt, Err: err}
+}
+
+// dateRange returns the first and last posted dates of transactions, widened by days either side
+func dateRange(transactions []ParsedTransaction, days int) (models.Date, models.Date) {
+	from, to := transactions[0].PostedDate, transactions[0].PostedDate
+	for _, t := range transactions[1:] {
+		from = min(from, t.PostedDate)
+		to = max(to, t.PostedDate)
+	}
+	return addDays(from, -days), addDays(to, days)
+}
+
+// addDays moves a date by a number of days; a date that doesn't parse is left alone
+func addDays(d models.Date, days int) models.Date {
+	t, err := time.Parse("2006-01-02", string(d))
+	if err != nil {
+		return d
+	}
+	return models.Date(t.AddDate(0, 0, days).Format("2006-01-02"))
+}
+
 func generateKey(date models.Date, amount models.Money, desc string) string {
 	return fmt.Sprintf("%s|%d|%s", date, amount, desc)
 }
+
+// keyIndex finds existing rows by the bank's transaction ID when there is one,
+// else by Date|Amount|Description and which occurrence of that key it is,
+// so two identical purchases on the same day stay two rows.
+// A row with an ID is never matched by key to an incoming row with a different ID,
+// but rows imported without IDs (e.g. from CSV) still match an incoming row that has one.
+type keyIndex struct {
+	byExternalID map[string]uint
+	byKey        map[string][]uint // IDs of the rows with a key, in the order added
+	keyHasID     map[string][]bool // whether each of those rows had an external ID
+}
+
+func newKeyIndex() *keyIndex {
+	return &keyIndex{
+		byExternalID: make(map[string]uint),
+		byKey:        make(map[string][]uint),
+		keyHasID:     make(map[string][]bool),
+	}
+}
+
+func (ix *keyIndex) add(id uint, date models.Date, amount models.Money, desc string, externalID string) {
+	key := generateKey(date, amount, desc)
+	ix.byKey[key] = append(ix.byKey[key], id)
+	ix.keyHasID[key] = append(ix.keyHasID[key], externalID != "")
+	if externalID != "" {
+		ix.byExternalID[externalID] = id
+	}
+}
+
+// find looks up the occurrence'th (0-based) row with the given key
+func (ix *keyIndex) find(date models.Date, amount models.Money, desc string, externalID string, occurrence int) (uint, bool) {
+	if externalID != "" {
+		if id, ok := ix.byExternalID[externalID]; ok {
+			return id, true
+		}
+	}
+	key := generateKey(date, amount, desc)
+	ids := ix.byKey[key]
+	if occurrence >= len(ids) {
+		return 0, false
+	}
+	if externalID != "" && ix.keyHasID[key][occurrence] {
+		return 0, false
+	}
+	return ids[occurrence], true
+}
@@ -0,0 +1,280 @@
+package transactionImport
+
+import (
+	"testing"
+	"wailts/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func processRaw(t *testing.T, db *gorm.DB, account string, parsed []ParsedTransaction) *ProcessSummary {
+	t.Helper()
+	summary, err := ProcessRaw(db, account, 0, parsed)
+	require.NoError(t, err)
+	return summary
+}
+
+func TestProcessRaw_ExternalID(t *testing.T) {
+	s := setupTestService(t)
+
+	// Two identical purchases on the same day, told apart only by the bank's ID
+	parsed := []ParsedTransaction{
+		{PostedDate: "2025-12-02", Amount: 475, Description: "COFFEE SHOP", Beneficiary: "Us", ExternalID: "1"},
+		{PostedDate: "2025-12-02", Amount: 475, Description: "COFFEE SHOP", Beneficiary: "Us", ExternalID: "2"},
+	}
+	processRaw(t, s.DB, "WfChecking", parsed)
+
+	// Re-importing the same download updates rather than duplicates
+	processRaw(t, s.DB, "WfChecking", parsed)
+
+	raws, err := s.GetRawTransactions()
+	require.NoError(t, err)
+	require.Len(t, raws, 2)
+	assert.ElementsMatch(t, []string{"1", "2"}, []string{raws[0].ExternalID, raws[1].ExternalID})
+	for _, r := range raws {
+		assert.Equal(t, "add", r.Action)
+	}
+}
+
+func TestProcessRaw_KeepsWhatTheUserGave(t *testing.T) {
+	s := setupTestService(t)
+	parsed := []ParsedTransaction{
+		{PostedDate: "2025-12-02", Amount: 4000, Description: "COSTCO", Beneficiary: "Us", Memo: "OLD"},
+	}
+	processRaw(t, s.DB, "WfChecking", parsed)
+	raws, err := s.GetRawTransactions()
+	require.NoError(t, err)
+	require.Len(t, raws, 1)
+	splits := `[{"Budget":"--unbudgeted--","Amount":2500},{"Budget":"--unbudgeted--","Amount":1500}]`
+	require.NoError(t, s.DB.Model(&raws[0]).Updates(map[string]any{
+		"budget": models.PLACEHOLDER_BUDGET, "tag": "costco", "proposed_splits": splits}).Error)
+
+	// An overlapping download refreshes what came from the bank, and only that
+	parsed[0].Memo = "NEW"
+	processRaw(t, s.DB, "WfChecking", parsed)
+	raws, err = s.GetRawTransactions()
+	require.NoError(t, err)
+	require.Len(t, raws, 1)
+	assert.Equal(t, "NEW", raws[0].Memo)
+	assert.Equal(t, models.PLACEHOLDER_BUDGET, raws[0].Budget)
+	assert.Equal(t, "costco", raws[0].Tag)
+	assert.Equal(t, splits, raws[0].ProposedSplits)
+}
+
+func TestProcessRaw_ExternalIDMatchesCSVImport(t *testing.T) {
+	s := setupTestService(t)
+
+	// Previously imported from CSV, so no bank ID
+	require.NoError(t, s.DB.Create(&models.Transaction{
+		PostedDate: "2025-12-02", Account: "WfChecking", Amount: 475, Description: "COFFEE SHOP",
+		Beneficiary: "Us", Budget: models.PLACEHOLDER_BUDGET,
+	}).Error)
+
+	processRaw(t, s.DB, "WfChecking", []ParsedTransaction{
+		{PostedDate: "2025-12-02", Amount: 475, Description: "COFFEE SHOP", ExternalID: "1"},
+	})
+
+	raws, err := s.GetRawTransactions()
+	require.NoError(t, err)
+	require.Len(t, raws, 1)
+	assert.Equal(t, "update", raws[0].Action)
+}
+
+func TestProcessRaw_IdenticalRowsSameDay(t *testing.T) {
+	s := setupTestService(t)
+
+	coffee := ParsedTransaction{PostedDate: "2025-12-02", Amount: 475, Description: "COFFEE SHOP", Beneficiary: "Us"}
+	parsed := []ParsedTransaction{coffee, coffee}
+	processRaw(t, s.DB, "WfChecking", parsed)
+	processRaw(t, s.DB, "WfChecking", parsed)
+
+	raws, err := s.GetRawTransactions()
+	require.NoError(t, err)
+	require.Len(t, raws, 2)
+	for _, r := range raws {
+		assert.Equal(t, "add", r.Action)
+		assert.Zero(t, r.DuplicateConfidence, "identical rows in one file are not duplicates")
+	}
+}
+
+func TestProcessRaw_OccurrenceMatchesTransaction(t *testing.T) {
+	s := setupTestService(t)
+
+	existing := models.Transaction{
+		PostedDate: "2025-12-02", Account: "WfChecking", Amount: 475, Description: "COFFEE SHOP",
+		Beneficiary: "Us", Budget: models.PLACEHOLDER_BUDGET,
+	}
+	require.NoError(t, s.DB.Create(&existing).Error)
+
+	// The first coffee was already finalized, the second is new
+	coffee := ParsedTransaction{PostedDate: "2025-12-02", Amount: 475, Description: "COFFEE SHOP", Beneficiary: "Us"}
+	processRaw(t, s.DB, "WfChecking", []ParsedTransaction{coffee, coffee})
+
+	var raws []models.RawTransaction
+	require.NoError(t, s.DB.Order("id").Find(&raws).Error)
+	require.Len(t, raws, 2)
+	assert.Equal(t, "update", raws[0].Action)
+	assert.Equal(t, existing.ID, raws[0].TransactionID)
+	assert.Equal(t, "add", raws[1].Action)
+	assert.Zero(t, raws[1].DuplicateOfTransaction)
+}
+
+func TestProcessRaw_FuzzyDuplicates(t *testing.T) {
+	s := setupTestService(t)
+
+	existing := models.Transaction{
+		PostedDate: "2025-12-01", Account: "WfChecking", Amount: 4550, Description: "KROGER #123",
+		Beneficiary: "Us", Budget: models.PLACEHOLDER_BUDGET,
+	}
+	require.NoError(t, s.DB.Create(&existing).Error)
+	staged := models.RawTransaction{
+		PostedDate: "2025-12-05", Account: "WfChecking", Amount: 1200, Description: "NETFLIX.COM", Action: "add",
+	}
+	require.NoError(t, s.DB.Create(&staged).Error)
+
+	processRaw(t, s.DB, "WfChecking", []ParsedTransaction{
+		// The bank reworded the description and moved the date by a day
+		{PostedDate: "2025-12-02", Amount: 4550, Description: "PURCHASE AUTHORIZED ON 11/30 KROGER #123"},
+		// Still in staging under its old description
+		{PostedDate: "2025-12-05", Amount: 1200, Description: "NETFLIX.COM 866-579-7172 CA"},
+		// Same amount, different merchant
+		{PostedDate: "2025-12-01", Amount: 4550, Description: "SAFEWAY"},
+		// Same merchant, too long after
+		{PostedDate: "2025-12-20", Amount: 4550, Description: "KROGER #123"},
+	})
+
+	byDesc := map[string]models.RawTransaction{}
+	raws, err := s.GetRawTransactions()
+	require.NoError(t, err)
+	for _, r := range raws {
+		byDesc[r.Description] = r
+	}
+
+	kroger := byDesc["PURCHASE AUTHORIZED ON 11/30 KROGER #123"]
+	assert.Equal(t, existing.ID, kroger.DuplicateOfTransaction)
+	assert.InDelta(t, 0.75, kroger.DuplicateConfidence, 0.001)
+
+	netflix := byDesc["NETFLIX.COM 866-579-7172 CA"]
+	assert.Equal(t, staged.ID, netflix.DuplicateOfRaw)
+	assert.InDelta(t, 1.0, netflix.DuplicateConfidence, 0.001)
+
+	assert.Zero(t, byDesc["SAFEWAY"].DuplicateConfidence)
+	assert.Zero(t, byDesc["KROGER #123"].DuplicateConfidence)
+}
+
+func TestProcessRaw_Chunks(t *testing.T) {
+	s := setupTestService(t)
+	oldChunkSize := ProcessChunkSize
+	ProcessChunkSize = 1
+	defer func() { ProcessChunkSize = oldChunkSize }()
+
+	// Identical rows and near-duplicates split across chunks are treated as if processed together
+	parsed := []ParsedTransaction{
+		{PostedDate: "2025-12-02", Amount: 475, Description: "COFFEE SHOP"},
+		{PostedDate: "2025-12-02", Amount: 475, Description: "COFFEE SHOP"},
+		{PostedDate: "2025-12-03", Amount: 475, Description: "COFFEE SHOP 2"},
+	}
+	summary := processRaw(t, s.DB, "WfChecking", parsed)
+	assert.Equal(t, &ProcessSummary{Added: 3}, summary)
+
+	summary = processRaw(t, s.DB, "WfChecking", parsed)
+	assert.Equal(t, &ProcessSummary{Updated: 3}, summary)
+
+	raws, err := s.GetRawTransactions()
+	require.NoError(t, err)
+	require.Len(t, raws, 3)
+	for _, r := range raws {
+		assert.Zero(t, r.DuplicateConfidence, r.Description)
+	}
+}
+
+func TestDateRange(t *testing.T) {
+	from, to := dateRange([]ParsedTransaction{
+		{PostedDate: "2025-03-01"},
+		{PostedDate: "2024-12-31"},
+		{PostedDate: "2025-02-01"},
+	}, 3)
+	assert.Equal(t, models.Date("2024-12-28"), from)
+	assert.Equal(t, models.Date("2025-03-04"), to)
+}
+
+func TestProcessRaw_ExternalIDDateChanged(t *testing.T) {
+	s := setupTestService(t)
+
+	processRaw(t, s.DB, "WfChecking", []ParsedTransaction{
+		{PostedDate: "2025-12-02", Amount: 475, Description: "COFFEE SHOP", ExternalID: "1"},
+	})
+	// The pending transaction posts a week later
+	summary := processRaw(t, s.DB, "WfChecking", []ParsedTransaction{
+		{PostedDate: "2025-12-09", Amount: 475, Description: "COFFEE SHOP", ExternalID: "1"},
+	})
+	assert.Equal(t, 1, summary.Updated)
+
+	raws, err := s.GetRawTransactions()
+	require.NoError(t, err)
+	require.Len(t, raws, 1)
+	assert.Equal(t, models.Date("2025-12-09"), raws[0].PostedDate)
+}
+
+// failOn makes the DB refuse to insert or update ("INSERT", "UPDATE") a raw transaction with the given description
+func failOn(t *testing.T, db *gorm.DB, event string, description string) {
+	t.Helper()
+	require.NoError(t, db.Exec(`CREATE TRIGGER fail_`+event+` BEFORE `+event+` ON raw_transactions
+		WHEN NEW.description = '`+description+`'
+		BEGIN SELECT RAISE(ABORT, 'injected failure'); END`).Error)
+}
+
+func TestProcessRaw_FailureMidFile(t *testing.T) {
+	s := setupTestService(t)
+	oldChunkSize := ProcessChunkSize
+	ProcessChunkSize = 2
+	defer func() { ProcessChunkSize = oldChunkSize }()
+
+	failOn(t, s.DB, "INSERT", "FAIL")
+	parsed := []ParsedTransaction{
+		{PostedDate: "2025-12-01", Amount: 100, Description: "ONE", Line: 2},
+		{PostedDate: "2025-12-02", Amount: 200, Description: "TWO", Line: 3},
+		{PostedDate: "2025-12-03", Amount: 300, Description: "THREE", Line: 4},
+		{PostedDate: "2025-12-04", Amount: 400, Description: "FAIL", Line: 5},
+		{PostedDate: "2025-12-05", Amount: 500, Description: "FIVE", Line: 6},
+	}
+	_, err := ProcessRaw(s.DB, "WfChecking", 0, parsed)
+
+	var rowErr *RowError
+	require.ErrorAs(t, err, &rowErr)
+	assert.Equal(t, 4, rowErr.Row)
+	assert.Equal(t, parsed[3], rowErr.Transaction)
+	assert.ErrorContains(t, err, "failed to stage line 5 (2025-12-04 4.00 FAIL): injected failure")
+
+	raws, err := s.GetRawTransactions()
+	require.NoError(t, err)
+	assert.Empty(t, raws, "the chunk before the failure is rolled back too")
+}
+
+func TestProcessRaw_FailedUpdate(t *testing.T) {
+	s := setupTestService(t)
+
+	parsed := []ParsedTransaction{
+		{PostedDate: "2025-12-01", Amount: 100, Description: "ONE", Beneficiary: "Us"},
+		{PostedDate: "2025-12-02", Amount: 200, Description: "FAIL", Beneficiary: "Us"},
+	}
+	processRaw(t, s.DB, "WfChecking", parsed)
+
+	// Re-importing with new beneficiaries fails on the second row
+	failOn(t, s.DB, "UPDATE", "FAIL")
+	parsed[0].Beneficiary = "Bob"
+	parsed[1].Beneficiary = "Bob"
+	_, err := ProcessRaw(s.DB, "WfChecking", 0, parsed)
+	var rowErr *RowError
+	require.ErrorAs(t, err, &rowErr)
+	assert.Equal(t, 2, rowErr.Row)
+
+	raws, err := s.GetRawTransactions()
+	require.NoError(t, err)
+	require.Len(t, raws, 2)
+	for _, r := range raws {
+		assert.Equal(t, "Us", r.Beneficiary, "%s unchanged", r.Description)
+	}
+}
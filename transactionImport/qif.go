@@ -0,0 +1,331 @@
+package transactionImport
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"iter"
+	"regexp"
+	"strconv"
+	"strings"
+	"wailts/models"
+
+	"gorm.io/gorm"
+)
+
+// QIFParser reads Quicken Interchange Format files, as exported by GnuCash,
+// Moneydance and older versions of Quicken.  A file may hold several
+// accounts, each introduced by an !Account record; only the transactions
+// of the account being imported are read.  Categories (L lines) become the
+// RawHint.  Investment accounts, category lists and the like are skipped.
+type QIFParser struct {
+	Account     string   // Transactions the file lists under another account are skipped
+	Number      string   // The account's number, which the file may name it by instead
+	Beneficiary string   // Every transaction's, see beneficiaryOrDefault
+	Currency    string   // Currency of the account, QIF doesn't say
+	DateLayouts []string // Month first unless the account's format says otherwise
+}
+
+// defaultQIFDateLayouts are tried after a QIF date like "1/ 5'25" is tidied to "1/5/2025"
+var defaultQIFDateLayouts = []string{"1/2/2006", "1/2/06", "2006-01-02"}
+
+// qifRecord is the lines of one record, up to its "^"
+type qifRecord struct {
+	line   int      // 1-based line the record starts on
+	lines  []string // As written
+	fields map[string]string
+	splits []qifSplit
+}
+
+// qifSplit is one S/E/$ group, a part of a transaction in its own category
+type qifSplit struct {
+	Category, Memo, Amount string
+}
+
+func (p *QIFParser) Rows(reader io.Reader) iter.Seq2[ParsedRow, error] {
+	return func(yield func(ParsedRow, error) bool) {
+		scanner := bufio.NewScanner(reader)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+		section := ""       // Lower case, e.g. "type:bank" or "account"
+		autoSwitch := false // While set, !Account records list accounts rather than start one
+		account := ""       // Account the following transactions belong to, "" if the file doesn't say
+		otherAccounts := map[string]bool{}
+		found := false
+		var rec *qifRecord
+
+		// flush handles a finished record, reporting whether to carry on
+		flush := func() bool {
+			r := rec
+			rec = nil
+			if r == nil {
+				return true
+			}
+			switch {
+			case section == "account":
+				if !autoSwitch {
+					account = r.fields["N"]
+				}
+				return true
+			case !qifTransactionSections[section]:
+				return true
+			case account != "" && p.Account != "" && !strings.EqualFold(account, p.Account) &&
+				!(p.Number != "" && accountNumberMatches(account, p.Number)):
+				otherAccounts[account] = true
+				return true
+			}
+			found = true
+			pt, err := p.transaction(r)
+			pt.Line = r.line
+			row := ParsedRow{Transaction: pt}
+			if err != nil {
+				row = rejectRow(r.line, strings.Join(r.lines, "\n"), err.Error())
+			}
+			return yield(row, nil)
+		}
+
+		for lineNo := 1; scanner.Scan(); lineNo++ {
+			line := strings.TrimRight(scanner.Text(), "\r")
+			if lineNo == 1 {
+				line = strings.TrimPrefix(line, "\ufeff")
+			}
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			if strings.HasPrefix(line, "!") {
+				if !flush() {
+					return
+				}
+				header := strings.ToLower(strings.TrimSpace(line[1:]))
+				switch header {
+				case "option:autoswitch":
+					autoSwitch = true
+				case "clear:autoswitch":
+					autoSwitch = false
+				default:
+					section = header
+				}
+				continue
+			}
+			if line[0] == '^' {
+				if !flush() {
+					return
+				}
+				continue
+			}
+			if rec == nil {
+				rec = &qifRecord{line: lineNo, fields: map[string]string{}}
+			}
+			rec.add(line)
+		}
+		if err := scanner.Err(); err != nil {
+			yield(ParsedRow{}, err)
+			return
+		}
+		// The last record should end with "^", but needn't
+		if !flush() {
+			return
+		}
+		if !found && len(otherAccounts) > 0 {
+			yield(ParsedRow{}, noTransactionsFor(p.Account, otherAccounts))
+		}
+	}
+}
+
+// qifTransactionSections are the !Type headers whose records are transactions we can import
+var qifTransactionSections = map[string]bool{
+	"type:bank":  true,
+	"type:cash":  true,
+	"type:ccard": true,
+	"type:oth a": true,
+	"type:oth l": true,
+}
+
+// add reads one line of a record: a code letter followed by its value
+func (r *qifRecord) add(line string) {
+	r.lines = append(r.lines, line)
+	code, value := line[:1], strings.TrimSpace(line[1:])
+	switch code {
+	case "S":
+		r.splits = append(r.splits, qifSplit{Category: value})
+		return
+	case "E", "$":
+		if len(r.splits) == 0 {
+			r.splits = append(r.splits, qifSplit{})
+		}
+		s := &r.splits[len(r.splits)-1]
+		if code == "E" {
+			s.Memo = value
+		} else {
+			s.Amount = value
+		}
+		return
+	}
+	if prev, ok := r.fields[code]; ok {
+		value = prev + "\n" + value // e.g. the lines of an A address
+	}
+	r.fields[code] = value
+}
+
+// sourceRow encodes the record as a JSON object keyed by code letter, with splits numbered from 1 ("S1", "$1")
+func (r *qifRecord) sourceRow() string {
+	row := make(map[string]string, len(r.fields)+3*len(r.splits))
+	for code, value := range r.fields {
+		row[code] = value
+	}
+	for i, s := range r.splits {
+		n := strconv.Itoa(i + 1)
+		row["S"+n], row["E"+n], row["$"+n] = s.Category, s.Memo, s.Amount
+	}
+	return encodeSourceRow(row)
+}
+
+// qifCheckNumber is an N field that is a check number, rather than e.g. "ATM" or "XFR"
+var qifCheckNumber = regexp.MustCompile(`^\d+$`)
+
+// transaction maps the fields of one record to a ParsedTransaction
+func (p *QIFParser) transaction(r *qifRecord) (ParsedTransaction, error) {
+	layouts := p.DateLayouts
+	if len(layouts) == 0 {
+		layouts = defaultQIFDateLayouts
+	}
+	postedDate, err := parseDate(tidyQIFDate(r.fields["D"]), layouts)
+	if err != nil {
+		return ParsedTransaction{}, fmt.Errorf("unable to parse date: %s", r.fields["D"])
+	}
+
+	// U is the same amount as T, written by newer versions of Quicken
+	written := r.fields["T"]
+	if written == "" {
+		written = r.fields["U"]
+	}
+	amount, err := ParseMoney(written)
+	if err != nil {
+		return ParsedTransaction{}, err
+	}
+
+	// M is the description if there's no payee
+	description, memo := r.fields["P"], r.fields["M"]
+	if description == "" {
+		description, memo = memo, ""
+	}
+
+	checkNumber := r.fields["N"]
+	if !qifCheckNumber.MatchString(checkNumber) {
+		checkNumber = checkNumberIn(description)
+	}
+
+	// A split transaction may leave L empty, or say "--Split--"
+	category := r.fields["L"]
+	if (category == "" || category == "--Split--") && len(r.splits) > 0 {
+		category = r.splits[0].Category
+	}
+
+	// QIF amounts are negative for money leaving the account, we want expenses positive
+	return ParsedTransaction{
+		PostedDate:  postedDate,
+		Amount:      -amount,
+		Currency:    p.Currency,
+		Description: description,
+		Beneficiary: beneficiaryOrDefault(p.Beneficiary),
+		RawHint:     category,
+		CheckNumber: checkNumber,
+		Memo:        memo,
+		SourceRow:   r.sourceRow(),
+	}, nil
+}
+
+// qifApostropheYear is the year after the apostrophe Quicken writes for 2000 onwards, e.g. "1/ 5' 5"
+var qifApostropheYear = regexp.MustCompile(`'(\d{1,2})$`)
+
+// tidyQIFDate removes the padding spaces from a QIF date and makes "'25" the year 2025
+func tidyQIFDate(s string) string {
+	s = strings.ReplaceAll(strings.TrimSpace(s), " ", "")
+	if m := qifApostropheYear.FindStringSubmatch(s); m != nil {
+		year, _ := strconv.Atoi(m[1])
+		s = s[:len(s)-len(m[0])] + fmt.Sprintf("/%d", 2000+year)
+	}
+	return s
+}
+
+// --- Export ---
+
+// ExportQIF writes every transaction to a QIF file, one !Account block per
+// account with its transactions oldest first.  The budget is the category,
+// unless it's the placeholder, and splits are written as QIF splits.
+// Amounts are written as QIF expects, negative for money leaving the account,
+// and in the transaction's own currency since QIF has no way to say which.
+// It returns the number of transactions written.
+func ExportQIF(db *gorm.DB, w io.Writer) (int, error) {
+	var allSplits []models.TransactionSplit
+	if err := db.Order("transaction_id, id").Find(&allSplits).Error; err != nil {
+		return 0, err
+	}
+	splits := make(map[uint][]models.TransactionSplit)
+	for _, sp := range allSplits {
+		splits[sp.TransactionID] = append(splits[sp.TransactionID], sp)
+	}
+
+	rows, err := db.Model(&models.Transaction{}).Where("deleted_at IS NULL").
+		Order("account, posted_date, id").Rows()
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	bw := bufio.NewWriter(w)
+	count := 0
+	account := ""
+	for rows.Next() {
+		var t models.Transaction
+		if err := db.ScanRows(rows, &t); err != nil {
+			return count, err
+		}
+		if count == 0 || t.Account != account {
+			account = t.Account
+			fmt.Fprintf(bw, "!Account\nN%s\nTBank\n^\n!Type:Bank\n", qifValue(account))
+		}
+		writeQIFTransaction(bw, &t, splits[t.ID])
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return count, err
+	}
+	return count, bw.Flush()
+}
+
+// writeQIFTransaction writes one transaction record, leaving out empty fields
+func writeQIFTransaction(w io.Writer, t *models.Transaction, splits []models.TransactionSplit) {
+	date := string(t.PostedDate)
+	if len(date) == 10 {
+		date = date[5:7] + "/" + date[8:10] + "/" + date[:4]
+	}
+	category := t.Budget
+	if category == models.PLACEHOLDER_BUDGET {
+		category = ""
+	}
+	fmt.Fprintf(w, "D%s\nT%s\n", date, -t.Amount)
+	for _, f := range []struct{ code, value string }{
+		{"N", t.CheckNumber},
+		{"P", t.Description},
+		{"M", t.Memo},
+		{"L", category},
+	} {
+		if v := qifValue(f.value); v != "" {
+			fmt.Fprintf(w, "%s%s\n", f.code, v)
+		}
+	}
+	for _, sp := range splits {
+		fmt.Fprintf(w, "S%s\n", qifValue(sp.Budget))
+		if v := qifValue(sp.Memo); v != "" {
+			fmt.Fprintf(w, "E%s\n", v)
+		}
+		fmt.Fprintf(w, "$%s\n", -sp.Amount)
+	}
+	fmt.Fprint(w, "^\n")
+}
+
+// qifValue puts a value on one line, since a line break would end the field
+func qifValue(s string) string {
+	return strings.TrimSpace(strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ").Replace(s))
+}
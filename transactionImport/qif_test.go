@@ -0,0 +1,182 @@
+package transactionImport
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"wailts/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// qifExport is laid out as GnuCash and Quicken write several accounts: a list of
+// them under AutoSwitch, then each account's transactions after its !Account record
+const qifExport = `!Option:AutoSwitch
+!Account
+NChecking
+TBank
+^
+NVisa
+TCCard
+^
+!Clear:AutoSwitch
+!Type:Cat
+NGroceries
+E
+^
+!Account
+NChecking
+TBank
+^
+!Type:Bank
+D12/ 1'25
+T-12.34
+PKROGER #123
+MWeekly shop
+LGroceries
+^
+D12/2/2025
+T2,500.00
+N
+PPAYROLL DEPOSIT
+LIncome:Salary
+^
+D12/3/25
+U-100.00
+T-100.00
+N1234
+PJoe's Lawn Care
+^
+D12/4/2025
+T-60.00
+PCOSTCO
+L--Split--
+SGroceries
+EFood
+$-40.00
+SHousehold
+$-20.00
+^
+D13/45/2025
+T-1.00
+PBAD DATE
+^
+!Account
+NVisa
+TCCard
+^
+!Type:CCard
+D12/5/2025
+T-5.00
+PCOFFEE
+LDining
+^
+`
+
+func TestQIFParser(t *testing.T) {
+	p := &QIFParser{Account: "Checking", Beneficiary: "Bob", Currency: "USD"}
+	got, err := ParseAll(p, strings.NewReader(qifExport))
+	require.NoError(t, err)
+	require.Len(t, got.Accepted, 4)
+	assert.JSONEq(t, `{"D":"12/4/2025","T":"-60.00","P":"COSTCO","L":"--Split--",
+		"S1":"Groceries","E1":"Food","$1":"-40.00","S2":"Household","E2":"","$2":"-20.00"}`, got.Accepted[3].SourceRow)
+
+	assert.Equal(t, []ParsedTransaction{
+		{PostedDate: "2025-12-01", Amount: 1234, Currency: "USD", Description: "KROGER #123", Beneficiary: "Bob", RawHint: "Groceries", Memo: "Weekly shop", Line: 19},
+		{PostedDate: "2025-12-02", Amount: -250000, Currency: "USD", Description: "PAYROLL DEPOSIT", Beneficiary: "Bob", RawHint: "Income:Salary", Line: 25},
+		{PostedDate: "2025-12-03", Amount: 10000, Currency: "USD", Description: "Joe's Lawn Care", Beneficiary: "Bob", CheckNumber: "1234", Line: 31},
+		{PostedDate: "2025-12-04", Amount: 6000, Currency: "USD", Description: "COSTCO", Beneficiary: "Bob", RawHint: "Groceries", Line: 37},
+	}, withoutSourceRows(got.Accepted))
+	assert.Equal(t, []RejectedRow{
+		{Line: 47, Raw: "D13/45/2025\nT-1.00\nPBAD DATE", Reason: "unable to parse date: 13/45/2025"},
+	}, got.Rejected)
+
+	// Only the other account's transactions
+	got, err = ParseAll(&QIFParser{Account: "visa"}, strings.NewReader(qifExport))
+	require.NoError(t, err)
+	require.Len(t, got.Accepted, 1)
+	assert.Equal(t, "COFFEE", got.Accepted[0].Description)
+	assert.Equal(t, "Us", got.Accepted[0].Beneficiary)
+
+	_, err = ParseAll(&QIFParser{Account: "Savings"}, strings.NewReader(qifExport))
+	assert.ErrorContains(t, err, "no transactions for account Savings, the file has accounts Checking, Visa")
+
+	// The file may name the account by the number it has
+	got, err = ParseAll(&QIFParser{Account: "WfVisa", Number: "VISA"}, strings.NewReader(qifExport))
+	require.NoError(t, err)
+	assert.Len(t, got.Accepted, 1)
+
+	// A single account file doesn't name it, and may have day first dates and no final "^"
+	got, err = ParseAll(&QIFParser{Account: "Savings", DateLayouts: []string{"2/1/2006"}},
+		strings.NewReader("\ufeff!Type:Bank\r\nD31/12/2025\r\nT-3.50\r\nPBAKERY"))
+	require.NoError(t, err)
+	assert.Equal(t, []ParsedTransaction{
+		{PostedDate: "2025-12-31", Amount: 350, Description: "BAKERY", Beneficiary: "Us", Line: 2},
+	}, withoutSourceRows(got.Accepted))
+}
+
+func TestGetParser_QIF(t *testing.T) {
+	s := setupTestService(t)
+	require.NoError(t, s.AddImportFormat(&models.ImportFormat{Name: "EuroBank", DateLayouts: "02.01.2006"}))
+	require.NoError(t, s.AddAccount(&models.Account{Name: "Sparkasse", Beneficiary: "Us", ImportFormat: "EuroBank", Currency: "EUR"}))
+
+	parser, err := GetParser(s.DB, "Sparkasse", "export.QIF")
+	require.NoError(t, err)
+	assert.Equal(t, &QIFParser{Account: "Sparkasse", Beneficiary: "Us", Currency: "EUR", DateLayouts: []string{"02.01.2006"}}, parser)
+
+	parser, err = GetParser(s.DB, "WfChecking", "export.qif")
+	require.NoError(t, err)
+	assert.Empty(t, parser.(*QIFParser).DateLayouts) // The built-in format has no QIF layouts
+}
+
+func TestExportQIF(t *testing.T) {
+	s := setupTestService(t)
+	require.NoError(t, s.AddBudget(&models.Budget{Name: "Groceries", Beneficiary: "Us"}))
+	for _, tx := range []models.Transaction{
+		{PostedDate: "2026-01-05", Account: "WfChecking", Amount: 1234, Description: "KROGER\n#123", Beneficiary: "Us", Budget: "Groceries", Memo: "Weekly shop"},
+		{PostedDate: "2026-01-02", Account: "WfChecking", Amount: 10000, Description: "CHECK # 1234", Beneficiary: "Us", Budget: models.PLACEHOLDER_BUDGET, CheckNumber: "1234"},
+		{PostedDate: "2026-01-03", Account: "CapitalOne", Amount: -50000, Description: "PAYMENT THANK YOU", Beneficiary: "Us", Budget: models.PLACEHOLDER_BUDGET},
+	} {
+		require.NoError(t, s.AddTransaction(&tx))
+	}
+
+	var out bytes.Buffer
+	n, err := ExportQIF(s.DB, &out)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, `!Account
+NCapitalOne
+TBank
+^
+!Type:Bank
+D01/03/2026
+T500.00
+PPAYMENT THANK YOU
+^
+!Account
+NWfChecking
+TBank
+^
+!Type:Bank
+D01/02/2026
+T-100.00
+N1234
+PCHECK # 1234
+^
+D01/05/2026
+T-12.34
+PKROGER #123
+MWeekly shop
+LGroceries
+^
+`, out.String())
+
+	// What's exported can be imported again
+	got, err := ParseAll(&QIFParser{Account: "WfChecking"}, bytes.NewReader(out.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, []ParsedTransaction{
+		{PostedDate: "2026-01-02", Amount: 10000, Description: "CHECK # 1234", Beneficiary: "Us", CheckNumber: "1234", Line: 15},
+		{PostedDate: "2026-01-05", Amount: 1234, Description: "KROGER #123", Beneficiary: "Us", RawHint: "Groceries", Memo: "Weekly shop", Line: 20},
+	}, withoutSourceRows(got.Accepted))
+}
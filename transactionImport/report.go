@@ -0,0 +1,12 @@
+package transactionImport
+
+// ImportReport tells the user what happened to each row of an imported file
+type ImportReport struct {
+	Message    string
+	Account    string        // Account imported into, useful when it was detected
+	BatchID    uint          // The ImportBatch recording this import
+	Accepted   int           // Rows staged into raw_transactions
+	Duplicates int           // Staged rows flagged as probable duplicates, for the user to review
+	Rejected   []RejectedRow // Rows that were dropped, and why
+	Warnings   []string      // E.g. the file was imported before
+}